@@ -0,0 +1,161 @@
+// Package bundle serialises keychain profiles into passphrase-encrypted
+// files for moving them between machines.
+package bundle
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	format  = "backup-profile-bundle"
+	version = 1
+
+	// scrypt parameters recommended for interactive use
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keyLen  = 32
+)
+
+// ErrDecrypt is returned by Open for a wrong passphrase or a corrupted file.
+var ErrDecrypt = errors.New("wrong passphrase or corrupted bundle")
+
+// file is the on-disk form of a bundle. The salt doesn't need
+// authenticating: changing it only yields a different key, which fails to
+// decrypt. The cost parameters are checked before deriving the key, as a
+// crafted file could otherwise make Open allocate gigabytes.
+type file struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	KDF        kdfParams `json:"kdf"`
+	Cipher     string    `json:"cipher"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+type kdfParams struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+type payload struct {
+	Profiles map[string]*keychain.Profile `json:"profiles"`
+}
+
+// Seal encrypts profiles, keyed by name, with a key derived from passphrase
+// using scrypt, and AES-256-GCM.
+func Seal(profiles map[string]*keychain.Profile, passphrase []byte) ([]byte, error) {
+	plaintext, err := json.Marshal(payload{Profiles: profiles})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal profiles")
+	}
+
+	f := file{
+		Format:  format,
+		Version: version,
+		KDF: kdfParams{
+			Name: "scrypt",
+			Salt: make([]byte, 16),
+			N:    scryptN,
+			R:    scryptR,
+			P:    scryptP,
+		},
+		Cipher: "aes-256-gcm",
+	}
+	if _, err := rand.Read(f.KDF.Salt); err != nil {
+		return nil, errors.Wrap(err, "generate salt")
+	}
+
+	aead, err := newAEAD(f.KDF, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plaintext, additionalData())
+
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Open decrypts a bundle created by Seal. It rejects bundles holding invalid
+// profile names or empty profiles.
+func Open(data []byte, passphrase []byte) (map[string]*keychain.Profile, error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, errors.Wrap(err, "parse bundle")
+	}
+
+	if f.Format != format {
+		return nil, errors.New("not a profile bundle")
+	}
+	if f.Version != version {
+		return nil, fmt.Errorf("unsupported bundle version %d", f.Version)
+	}
+	if f.KDF.Name != "scrypt" || f.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported bundle encryption %s/%s", f.KDF.Name, f.Cipher)
+	}
+	if f.KDF.N != scryptN || f.KDF.R != scryptR || f.KDF.P != scryptP {
+		return nil, fmt.Errorf("unsupported scrypt parameters N=%d r=%d p=%d", f.KDF.N, f.KDF.R, f.KDF.P)
+	}
+
+	aead, err := newAEAD(f.KDF, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, additionalData())
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	var p payload
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return nil, errors.Wrap(err, "unmarshal profiles")
+	}
+	for name, profile := range p.Profiles {
+		if err := keychain.ValidateProfileName(name); err != nil {
+			return nil, err
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("profile %s is empty", name)
+		}
+	}
+	return p.Profiles, nil
+}
+
+func newAEAD(params kdfParams, passphrase []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, keyLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create cipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.Wrap(err, "create gcm")
+}
+
+// additionalData binds the ciphertext to the bundle format and version.
+func additionalData() []byte {
+	return []byte(fmt.Sprintf("%s v%d", format, version))
+}
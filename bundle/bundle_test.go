@@ -0,0 +1,79 @@
+package bundle
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	profiles := map[string]*keychain.Profile{
+		"nas": {
+			ResticRepository: "rest:https://nas:8000/repo",
+			ResticPassword:   "hunter2",
+			Env:              map[string]string{"RESTIC_REST_PASSWORD": "rest-secret"},
+		},
+		"b2": {
+			ResticRepository: "b2:bucket:path",
+			ResticPassword:   "correct horse",
+		},
+	}
+
+	data, err := Seal(profiles, []byte("passphrase"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+	assert.NotContains(t, string(data), "rest-secret")
+
+	opened, err := Open(data, []byte("passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, profiles, opened)
+
+	_, err = Open(data, []byte("wrong"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	// tampering with the parameters only yields a different key
+	var f file
+	require.NoError(t, json.Unmarshal(data, &f))
+	f.KDF.Salt[0] ^= 1
+	tampered, err := json.Marshal(f)
+	require.NoError(t, err)
+	_, err = Open(tampered, []byte("passphrase"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	// an expensive key derivation is refused before any work is done
+	require.NoError(t, json.Unmarshal(data, &f))
+	f.KDF.N = 1 << 30
+	expensive, err := json.Marshal(f)
+	require.NoError(t, err)
+	_, err = Open(expensive, []byte("passphrase"))
+	assert.EqualError(t, err, "unsupported scrypt parameters N=1073741824 r=8 p=1")
+
+	_, err = Open([]byte(`{"format":"other"}`), []byte("passphrase"))
+	assert.EqualError(t, err, "not a profile bundle")
+}
+
+func TestOpenRejectsInvalidProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles map[string]*keychain.Profile
+		expected string
+	}{
+		{"nil profile", map[string]*keychain.Profile{"x": nil}, "profile x is empty"},
+		{"empty name", map[string]*keychain.Profile{"": {}}, `invalid profile name ""`},
+		{"shell code", map[string]*keychain.Profile{"x$(id)": {}}, `invalid profile name "x$(id)"`},
+		{"path", map[string]*keychain.Profile{"../x": {}}, `invalid profile name "../x"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := Seal(test.profiles, []byte("passphrase"))
+			require.NoError(t, err)
+
+			_, err = Open(data, []byte("passphrase"))
+			assert.EqualError(t, err, test.expected)
+		})
+	}
+}
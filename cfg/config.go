@@ -1,20 +1,76 @@
 package cfg
 
+import "time"
+
+// BackupTarget is a restic repository to back up to. The repository,
+// password, AWS and env values may hold a secret reference such as
+// "keychain:work-nas", "env:NAS_PW", "file:/run/secrets/pw" or
+// "cmd:pass show backup/nas", which is resolved when the target is used.
 type BackupTarget struct {
+	Name               string `toml:"name"`
 	AwsAccessKeyId     string `toml:"aws_access_key_id"`
 	AwsSecretAccessKey string `toml:"aws_secret_access_key"`
 	ResticRepository   string `toml:"restic_repository"`
 	ResticPassword     string `toml:"restic_password"`
 	CACertPath         string `toml:"ca_cert_path"`
+
+	// Env holds further variables for restic, typically backend credentials
+	// such as B2_ACCOUNT_ID and B2_ACCOUNT_KEY.
+	Env map[string]string `toml:"env"`
+
+	// ReplicaOf names the target or keychain profile this target is a replica
+	// of. Replicas aren't backed up to; instead, new snapshots are copied to
+	// them from the primary after it has been backed up.
+	ReplicaOf string `toml:"replica_of"`
+
+	// KeychainProfile is set on targets loaded from a keychain profile.
+	KeychainProfile string `toml:"-"`
 }
 
 type KeychainProfile struct {
-	Profile string
+	Profile   string
+	ReplicaOf string `toml:"replica_of"`
+}
+
+// PingConfig describes healthchecks-style dead-man's-switch URLs. When URL is
+// set, the start and fail URLs default to URL+"/start" and URL+"/fail".
+// Retries is the number of times a failed ping is repeated after the first
+// attempt, 2 when unset; a negative value disables retrying.
+type PingConfig struct {
+	URL        string        `toml:"url"`
+	StartURL   string        `toml:"start_url"`
+	SuccessURL string        `toml:"success_url"`
+	FailURL    string        `toml:"fail_url"`
+	Timeout    time.Duration `toml:"timeout"`
+	Retries    int           `toml:"retries"`
+}
+
+// ProgressConfig controls how often status messages are forwarded. A status is
+// forwarded when PercentDone crosses a multiple of Quantum or MaxInterval has
+// passed since the last one, but never more often than MinInterval.
+type ProgressConfig struct {
+	MinInterval time.Duration `toml:"min_interval"`
+	MaxInterval time.Duration `toml:"max_interval"`
+	Quantum     float64       `toml:"quantum"`
+}
+
+// EventLogConfig controls rotation of the per-run event logs. Run logs larger
+// than MaxSize are continued in a new file, and files older than MaxAge are
+// removed.
+type EventLogConfig struct {
+	MaxSize int64         `toml:"max_size"`
+	MaxAge  time.Duration `toml:"max_age"`
 }
 
 type BackupConfig struct {
+	Job              string            `toml:"job"`
 	ResticPath       string            `toml:"restic_path"`
 	SourceHost       string            `toml:"source_host"`
 	Targets          []BackupTarget    `toml:"targets"`
 	KeychainProfiles []KeychainProfile `toml:"keychain_profiles"`
+	Ping             PingConfig        `toml:"ping"`
+	MaxSnapshotAge   time.Duration     `toml:"max_snapshot_age"`
+	Progress         ProgressConfig    `toml:"progress"`
+	StateDir         string            `toml:"state_dir"`
+	EventLog         EventLogConfig    `toml:"event_log"`
 }
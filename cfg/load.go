@@ -0,0 +1,47 @@
+package cfg
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+const defaultResticPath = "restic"
+
+func Load(path string) (*BackupConfig, error) {
+	var result BackupConfig
+	if _, err := toml.DecodeFile(path, &result); err != nil {
+		return nil, errors.Wrap(err, "decode config")
+	}
+
+	if result.ResticPath == "" {
+		result.ResticPath = defaultResticPath
+	}
+
+	return &result, nil
+}
+
+// DefaultStateDir returns $XDG_STATE_HOME/backup, falling back to
+// ~/.local/state/backup.
+func DefaultStateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "backup"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "get home dir")
+	}
+
+	return filepath.Join(home, ".local", "state", "backup"), nil
+}
+
+// StateDirectory returns the configured state directory or the default one.
+func (c *BackupConfig) StateDirectory() (string, error) {
+	if c.StateDir != "" {
+		return os.ExpandEnv(c.StateDir), nil
+	}
+	return DefaultStateDir()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/minor-industries/backup/eventlog"
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+)
+
+type BackupCommand struct {
+	ConfigOptions
+	Chdir string `long:"chdir" description:"Directory to run the backup from"`
+	Args  struct {
+		Paths []string `positional-arg-name:"path" required:"1"`
+	} `positional-args:"true"`
+}
+
+func (cmd *BackupCommand) Execute(args []string) error {
+	opts, err := cfg.Load(cmd.Config)
+	if err != nil {
+		return errors.Wrap(err, "load config")
+	}
+
+	stateDir, err := opts.StateDirectory()
+	if err != nil {
+		return errors.Wrap(err, "get state dir")
+	}
+
+	events, err := eventlog.Open(eventlog.Dir(stateDir), opts.EventLog)
+	if err != nil {
+		return errors.Wrap(err, "open event log")
+	}
+	defer events.Close()
+
+	var runID string
+	callback := restic.Callback(restic.Tee(
+		restic.ObserverFunc(events.Callback()),
+		restic.ObserverFunc(restic.ProgressRenderer(os.Stdout, opts.Progress)),
+	))
+
+	err = restic.Run(opts, cmd.Chdir, cmd.Args.Paths, func(msg any) error {
+		meta, _ := restic.Unwrap(msg)
+		if runID == "" {
+			runID = meta.RunID
+		}
+		return callback(msg)
+	})
+	if runID != "" {
+		fmt.Printf("run id: %s\n", runID)
+	}
+	return errors.Wrap(err, "run backup")
+}
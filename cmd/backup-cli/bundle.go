@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/minor-industries/backup/bundle"
+	"github.com/minor-industries/backup/keychain"
+	"github.com/minor-industries/backup/secrets"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+type PassphraseOptions struct {
+	Passphrase string `long:"passphrase" description:"Secret reference to read the bundle passphrase from instead of prompting, e.g. env:BUNDLE_PASSPHRASE or file:/path" value-name:"REF"`
+}
+
+// passphrase resolves --passphrase or prompts for the passphrase, twice when
+// confirm is set.
+func (o *PassphraseOptions) passphrase(confirm bool) ([]byte, error) {
+	value, err := readSecret(o.Passphrase, "--passphrase", "Bundle passphrase", confirm)
+	return []byte(value), err
+}
+
+type ExportCommand struct {
+	PassphraseOptions
+	Profiles []string `short:"p" long:"profile" description:"Profile to export (repeatable)"`
+	All      bool     `long:"all" description:"Export all profiles"`
+	Out      string   `short:"o" long:"out" description:"Bundle file to write" required:"true"`
+	Force    bool     `long:"force" description:"Overwrite an existing bundle file"`
+}
+
+func (cmd *ExportCommand) Execute(args []string) error {
+	names := cmd.Profiles
+	if cmd.All {
+		var err error
+		names, err = keychain.ListProfiles()
+		if err != nil {
+			return errors.Wrap(err, "list profiles")
+		}
+	}
+	if len(names) == 0 {
+		return errors.New("no profiles selected, use -p or --all")
+	}
+
+	profiles := map[string]*keychain.Profile{}
+	for _, name := range lo.Uniq(names) {
+		profile, err := keychain.LoadProfile(name)
+		if err != nil {
+			return errors.Wrapf(err, "load profile %s", name)
+		}
+		profiles[name] = profile
+	}
+
+	passphrase, err := cmd.passphrase(true)
+	if err != nil {
+		return err
+	}
+
+	data, err := bundle.Seal(profiles, passphrase)
+	if err != nil {
+		return errors.Wrap(err, "seal bundle")
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !cmd.Force {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(cmd.Out, flags, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "create bundle")
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write bundle")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "write bundle")
+	}
+
+	fmt.Printf("Exported %d profile(s) to %s\n", len(profiles), cmd.Out)
+	return nil
+}
+
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+type ImportCommand struct {
+	PassphraseOptions
+	Profiles        []string `short:"p" long:"profile" description:"Only import this profile (repeatable)"`
+	OnConflict      string   `long:"on-conflict" description:"What to do with profiles that already exist" choice:"skip" choice:"overwrite" choice:"rename" default:"skip"`
+	AllowReferences bool     `long:"allow-references" description:"Import profiles containing secret references such as cmd: or file:, which are resolved on every use"`
+	Args            struct {
+		Bundle string `positional-arg-name:"bundle" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (cmd *ImportCommand) Execute(args []string) error {
+	data, err := os.ReadFile(cmd.Args.Bundle)
+	if err != nil {
+		return errors.Wrap(err, "read bundle")
+	}
+
+	passphrase, err := cmd.passphrase(false)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := bundle.Open(data, passphrase)
+	if err != nil {
+		return errors.Wrap(err, "open bundle")
+	}
+
+	for _, name := range cmd.Profiles {
+		if _, ok := profiles[name]; !ok {
+			return fmt.Errorf("profile %s is not in the bundle", name)
+		}
+	}
+
+	names := lo.Keys(profiles)
+	sort.Strings(names)
+	if len(cmd.Profiles) > 0 {
+		names = lo.Filter(names, func(name string, _ int) bool { return lo.Contains(cmd.Profiles, name) })
+	}
+
+	if !cmd.AllowReferences {
+		if err := checkReferences(names, profiles); err != nil {
+			return err
+		}
+	}
+
+	existing, err := keychain.ListProfiles()
+	if err != nil {
+		return errors.Wrap(err, "list profiles")
+	}
+
+	for _, name := range names {
+		if err := cmd.importProfile(name, profiles[name], &existing); err != nil {
+			return errors.Wrapf(err, "import profile %s", name)
+		}
+	}
+
+	return nil
+}
+
+// checkReferences refuses profiles holding secret references. They are
+// resolved whenever the profile is used, so a bundle from someone else could
+// run commands ("cmd:"), read files ("file:") or pass other secrets
+// ("env:", "keychain:") to a backend it controls.
+func checkReferences(names []string, profiles map[string]*keychain.Profile) error {
+	var found []string
+	for _, name := range names {
+		profile := profiles[name]
+		for _, v := range profile.Names() {
+			if scheme, ok := secrets.Scheme(profile.Get(v)); ok && scheme != "literal" {
+				found = append(found, fmt.Sprintf("%s: %s is a %s: reference", name, v, scheme))
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	for _, line := range found {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	return errors.New("the bundle contains secret references, check them and use --allow-references to import")
+}
+
+func (cmd *ImportCommand) importProfile(
+	name string,
+	profile *keychain.Profile,
+	existing *[]string,
+) error {
+	if !lo.Contains(*existing, name) {
+		if err := keychain.NewProfile(name, profile); err != nil {
+			return err
+		}
+		*existing = append(*existing, name)
+		fmt.Printf("imported %s\n", name)
+		return nil
+	}
+
+	switch cmd.OnConflict {
+	case conflictOverwrite:
+		if err := keychain.UpdateProfile(name, profile); err != nil {
+			return err
+		}
+		fmt.Printf("overwrote %s\n", name)
+
+	case conflictRename:
+		newName := name
+		for i := 2; lo.Contains(*existing, newName); i++ {
+			newName = fmt.Sprintf("%s-%d", name, i)
+		}
+		if err := keychain.NewProfile(newName, profile); err != nil {
+			return err
+		}
+		*existing = append(*existing, newName)
+		fmt.Printf("imported %s as %s\n", name, newName)
+
+	default:
+		fmt.Printf("skipped %s (already exists)\n", name)
+	}
+
+	return nil
+}
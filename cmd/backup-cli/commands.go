@@ -2,31 +2,38 @@ package main
 
 import (
 	"fmt"
+	"github.com/minor-industries/backup/cfg"
 	"github.com/minor-industries/backup/keychain"
+	"github.com/minor-industries/backup/restic"
+	"github.com/minor-industries/backup/secrets"
 	"github.com/peterh/liner"
 	"github.com/pkg/errors"
 	"os"
-	"syscall"
+	"strings"
 )
 
 type ProfileOptions struct {
 	Profile string `short:"p" long:"profile" description:"Profile to use" required:"true"`
 }
 
-type field struct {
-	name     string
-	required bool
-	secret   bool
+// RepositoryOptions select the profile whose repository a command works on.
+type RepositoryOptions struct {
+	ProfileOptions
+	ResticOptions
 }
 
-var fields = []field{
-	{"AWS_ACCESS_KEY_ID", false, false},
-	{"AWS_SECRET_ACCESS_KEY", false, true},
-	{"RESTIC_REPOSITORY", true, false},
-	{"RESTIC_PASSWORD", true, true},
+// target returns the options and the target of the selected profile.
+func (o *RepositoryOptions) target() (*cfg.BackupConfig, *cfg.BackupTarget, error) {
+	profile, err := keychain.LoadProfile(o.Profile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "load profile")
+	}
+
+	target := restic.ProfileTarget(o.Profile, profile)
+	return o.config(), &target, nil
 }
 
-func readField(f field) (string, error) {
+func readVar(v restic.EnvVar) (string, error) {
 	line := liner.NewLiner()
 	defer line.Close()
 
@@ -34,10 +41,10 @@ func readField(f field) (string, error) {
 
 	var res string
 	var err error
-	if f.secret {
-		res, err = line.PasswordPrompt("(secret) " + f.name + "=")
+	if v.Secret {
+		res, err = line.PasswordPrompt("(secret) " + v.Name + "=")
 	} else {
-		res, err = line.Prompt(f.name + "=")
+		res, err = line.Prompt(v.Name + "=")
 	}
 
 	if err != nil {
@@ -47,117 +54,105 @@ func readField(f field) (string, error) {
 	return res, nil
 }
 
-type NewCommand struct {
-	ProfileOptions
-}
-
-func (cmd *NewCommand) Execute(args []string) error {
-	fmt.Println("new profile")
-
-	result := map[string]string{}
-
-	for _, field := range fields {
-	retry:
-		value, err := readField(field)
+// readRequiredVar prompts for v until a value is given if v is required.
+func readRequiredVar(v restic.EnvVar) (string, error) {
+	for {
+		value, err := readVar(v)
 		if err != nil {
-			return errors.Wrap(err, "read field")
+			return "", errors.Wrap(err, "read field")
 		}
 
-		if value == "" {
-			if field.required {
-				fmt.Printf("%s is required\n", field.name)
-				goto retry
-			}
+		if value != "" || !v.Required {
+			return value, nil
 		}
 
-		if value != "" {
-			result[field.name] = value
-		}
+		fmt.Printf("%s is required\n", v.Name)
 	}
-
-	return keychain.NewProfile(cmd.Profile, &keychain.Profile{
-		AwsAccessKeyID:     result["AWS_ACCESS_KEY_ID"],
-		AwsSecretAccessKey: result["AWS_SECRET_ACCESS_KEY"],
-		ResticRepository:   result["RESTIC_REPOSITORY"],
-		ResticPassword:     result["RESTIC_PASSWORD"],
-	})
 }
 
-type ListCommand struct{}
-
-func (cmd *ListCommand) Execute(args []string) error {
-	results, err := keychain.ListProfiles()
-	if err != nil {
-		return errors.Wrap(err, "list profiles")
-	}
+// readExtraVars prompts for further variables, e.g. RCLONE_CONFIG_*, until
+// an empty name is given.
+func readExtraVars(profile *keychain.Profile) error {
+	for {
+		name, err := readVar(restic.EnvVar{Name: "extra variable name (empty to finish)"})
+		if err != nil {
+			return errors.Wrap(err, "read name")
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil
+		}
 
-	if len(results) == 0 {
-		fmt.Println("No profiles found.")
-		return nil
+		value, err := readVar(restic.EnvVar{Name: name, Secret: restic.IsSecretEnvVar(name)})
+		if err != nil {
+			return errors.Wrap(err, "read value")
+		}
+		profile.Set(name, value)
 	}
+}
 
-	for _, result := range results {
-		fmt.Println(result)
+// readSecret resolves ref, which must be a secret reference given with the
+// named flag, or else prompts for the secret, twice when confirm is set.
+func readSecret(ref string, flag string, prompt string, confirm bool) (string, error) {
+	if ref != "" {
+		if !secrets.IsReference(ref) {
+			return "", fmt.Errorf("%s must be a secret reference such as env:NAME or file:PATH", flag)
+		}
+		return secrets.Resolve(ref, flag)
 	}
 
-	return nil
-}
+	line := liner.NewLiner()
+	defer line.Close()
 
-type ShellCommand struct {
-	ProfileOptions
-}
+	line.SetCtrlCAborts(true)
 
-func (cmd *ShellCommand) Execute(args []string) error {
-	result, err := keychain.LoadProfile(cmd.Profile)
+	value, err := line.PasswordPrompt(prompt + ": ")
 	if err != nil {
-		return errors.Wrap(err, "load profile")
+		return "", errors.Wrap(err, "get line")
 	}
-
-	env := []string{
-		"AWS_ACCESS_KEY_ID", result.AwsAccessKeyID,
-		"AWS_SECRET_ACCESS_KEY", result.AwsSecretAccessKey,
-		"RESTIC_REPOSITORY", result.ResticRepository,
-		"RESTIC_PASSWORD", result.ResticPassword,
+	if value == "" {
+		return "", fmt.Errorf("%s must not be empty", strings.ToLower(prompt))
 	}
-	for i := 0; i < len(env); i += 2 {
-		k, v := env[i], env[i+1]
-		err := os.Setenv(k, v)
+
+	if confirm {
+		again, err := line.PasswordPrompt("Repeat " + strings.ToLower(prompt) + ": ")
 		if err != nil {
-			return errors.Wrap(err, "set env")
+			return "", errors.Wrap(err, "get line")
+		}
+		if again != value {
+			return "", errors.New("entries don't match")
 		}
 	}
 
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/sh"
-	}
-
-	// [[ -n "$CUSTOM_PS1" ]] && PS1="$CUSTOM_PS1"
-	normalPS1 := "%n@%m %1~ %# "
-	customPS1 := fmt.Sprintf("[%s] %s", cmd.Profile, normalPS1)
-	if err := os.Setenv("CUSTOM_PS1", customPS1); err != nil {
-		return errors.Wrap(err, "set env")
-	}
-
-	return syscall.Exec(shell, []string{shell}, os.Environ())
+	return value, nil
 }
 
-type EditCommand struct {
-	ProfileOptions
+// profileEnv returns the current environment with the variables of the
+// given profile, their secret references resolved, in place of any
+// inherited restic or backend variables.
+func profileEnv(profileName string) ([]string, error) {
+	profile, err := keychain.LoadProfile(profileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "load profile")
+	}
+	return composeEnv(os.Environ(), profile)
 }
 
-func (cmd *EditCommand) Execute(args []string) error {
-	line := liner.NewLiner()
-	defer line.Close()
+// composeEnv returns environ with the variables of profile added.
+func composeEnv(environ []string, profile *keychain.Profile) ([]string, error) {
+	// don't let credentials of another backend leak into the profile's
+	// environment
+	env := restic.FilterEnv(environ, profile.Names())
 
-	line.SetCtrlCAborts(true)
-	res, err := line.Prompt("AWS_SOMETHING_SOMETHING=")
-	if err != nil {
-		return errors.Wrap(err, "get line")
+	for _, name := range profile.Names() {
+		value, err := secrets.Resolve(profile.Get(name), name)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, name+"="+value)
 	}
 
-	fmt.Println(res)
-	return nil
+	return env, nil
 }
 
 type DeleteCommand struct {
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+type CompareCommand struct {
+	ConfigOptions
+	Host      string        `long:"host" description:"Only compare snapshots of this host (default: source_host, all hosts when unset)"`
+	Paths     []string      `long:"path" description:"Only compare snapshots of this path (repeatable)"`
+	Tags      []string      `long:"tag" description:"Only compare snapshots with these comma-separated tags (repeatable)"`
+	Tolerance time.Duration `long:"tolerance" description:"How far apart snapshots with different trees may be and still match" default:"1h"`
+	JSON      bool          `long:"json" description:"Print the comparison as JSON"`
+}
+
+func (cmd *CompareCommand) Execute(args []string) error {
+	opts, err := cfg.Load(cmd.Config)
+	if err != nil {
+		return errors.Wrap(err, "load config")
+	}
+
+	host := cmd.Host
+	if host == "" {
+		host = opts.SourceHost
+	}
+
+	result := restic.Compare(opts, restic.CompareOptions{
+		Host:      host,
+		Paths:     cmd.Paths,
+		Tags:      cmd.Tags,
+		Tolerance: cmd.Tolerance,
+	})
+
+	if cmd.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return errors.Wrap(err, "encode comparison")
+		}
+	} else {
+		printComparison(result)
+	}
+
+	return failedTargets(result)
+}
+
+// failedTargets returns an error when some targets couldn't be listed, so
+// the comparison is incomplete.
+func failedTargets(result *restic.Comparison) error {
+	failed := lo.CountBy(result.Targets, func(t restic.TargetSnapshots) bool { return t.Error != "" })
+	if failed > 0 {
+		return fmt.Errorf("%d of %d target(s) could not be listed", failed, len(result.Targets))
+	}
+	return nil
+}
+
+func printComparison(result *restic.Comparison) {
+	lag := map[string]restic.TargetLag{}
+	for _, l := range result.Behind {
+		lag[l.Target] = l
+	}
+
+	var listed []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tSNAPSHOTS\tSTATE")
+	for _, target := range result.Targets {
+		if target.Error != "" {
+			fmt.Fprintf(w, "%s\t-\terror: %s\n", target.Target, target.Error)
+			continue
+		}
+		listed = append(listed, target.Target)
+
+		state := "up to date"
+		if l, ok := lag[target.Target]; ok {
+			state = fmt.Sprintf("behind by %d snapshot(s)", l.Missing)
+			if !l.Latest.IsZero() {
+				state += fmt.Sprintf(", latest %s", l.Latest.Local().Format(time.RFC3339))
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", target.Target, len(target.Snapshots), state)
+	}
+	w.Flush()
+
+	if len(result.Gaps) == 0 {
+		fmt.Printf("\nAll %d snapshot(s) are present on every target.\n", len(result.Matches))
+		return
+	}
+
+	fmt.Printf("\n%d of %d snapshot(s) are missing from some targets:\n", len(result.Gaps), len(result.Matches))
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "TIME\tHOST\tPATHS\t%s\n", strings.Join(listed, "\t"))
+	for _, gap := range result.Gaps {
+		fmt.Fprintf(w, "%s\t%s\t%s", gap.Time.Local().Format(time.RFC3339), gap.Hostname, strings.Join(gap.Paths, ","))
+		for _, name := range listed {
+			id, ok := gap.Snapshots[name]
+			if !ok {
+				id = "-"
+			}
+			fmt.Fprintf(w, "\t%s", shortID(id))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
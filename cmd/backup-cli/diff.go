@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+type DiffCommand struct {
+	RepositoryOptions
+	Host    string `long:"host" description:"Without snapshot arguments, diff the latest snapshot of this host"`
+	Summary bool   `long:"summary" description:"Only print the statistics"`
+	JSON    bool   `long:"json" description:"Print the changes and statistics as JSON"`
+	Args    struct {
+		From string `positional-arg-name:"from" description:"Snapshot to compare from, or alone the snapshot to compare with its parent"`
+		To   string `positional-arg-name:"to" description:"Snapshot to compare to (default: the latest snapshot)"`
+	} `positional-args:"true"`
+}
+
+// Execute compares two snapshots. Given one snapshot, it is compared with
+// its parent; given none, the latest snapshot is.
+func (cmd *DiffCommand) Execute(args []string) error {
+	opts, target, err := cmd.target()
+	if err != nil {
+		return err
+	}
+
+	from, to := cmd.Args.From, cmd.Args.To
+	if to == "" {
+		from, to, err = cmd.parentOf(opts, target, from)
+		if err != nil {
+			return err
+		}
+	}
+
+	diff, err := restic.Diff(opts, target, from, to)
+	if err != nil {
+		return errors.Wrap(err, "diff")
+	}
+
+	if cmd.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(diff), "encode diff")
+	}
+
+	if !cmd.Summary {
+		for _, change := range diff.Changes {
+			fmt.Printf("%-4s %s\n", change.Modifier, change.Path)
+		}
+		if len(diff.Changes) > 0 {
+			fmt.Println()
+		}
+	}
+
+	printDiffStatistics(&diff.Statistics)
+	return nil
+}
+
+// parentOf returns the parent of the snapshot id, or of the latest snapshot
+// when id is empty, and the snapshot itself.
+func (cmd *DiffCommand) parentOf(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	id string,
+) (string, string, error) {
+	snapshots, err := restic.Snapshots(opts, target, cmd.Host)
+	if err != nil {
+		return "", "", errors.Wrap(err, "list snapshots")
+	}
+
+	var snapshot restic.ResticSnapshot
+	if id == "" {
+		if len(snapshots) == 0 {
+			return "", "", errors.New("no snapshots found")
+		}
+		snapshot = lo.MaxBy(snapshots, func(a, b restic.ResticSnapshot) bool {
+			return a.Time.After(b.Time)
+		})
+	} else {
+		var ok bool
+		snapshot, ok = lo.Find(snapshots, func(s restic.ResticSnapshot) bool {
+			return strings.HasPrefix(s.ID, id)
+		})
+		if !ok {
+			return "", "", fmt.Errorf("snapshot %s not found", id)
+		}
+	}
+
+	if snapshot.Parent == "" {
+		return "", "", fmt.Errorf("snapshot %s (%s) has no parent to compare with",
+			snapshot.ShortID, snapshot.Time.Local().Format(time.RFC3339))
+	}
+
+	return snapshot.Parent, snapshot.ID, nil
+}
+
+func printDiffStatistics(stats *restic.ResticDiffStatistics) {
+	fmt.Printf("Comparing snapshot %s to %s: %d changed file(s)\n",
+		shortID(stats.SourceSnapshot), shortID(stats.TargetSnapshot), stats.ChangedFiles)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\tADDED\tREMOVED\t")
+	rows := []struct {
+		name           string
+		added, removed any
+	}{
+		{"Files", stats.Added.Files, stats.Removed.Files},
+		{"Dirs", stats.Added.Dirs, stats.Removed.Dirs},
+		{"Others", stats.Added.Others, stats.Removed.Others},
+		{"Data blobs", stats.Added.DataBlobs, stats.Removed.DataBlobs},
+		{"Tree blobs", stats.Added.TreeBlobs, stats.Removed.TreeBlobs},
+		{"Bytes", restic.FormatBytes(stats.Added.Bytes), restic.FormatBytes(stats.Removed.Bytes)},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%v\t%v\t\n", row.name, row.added, row.removed)
+	}
+	w.Flush()
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/minor-industries/backup/restic"
+	"github.com/peterh/liner"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+type EditCommand struct {
+	ProfileOptions
+	VerifyOptions
+	MetaOptions
+	Set []string `long:"set" description:"Set KEY=VALUE without prompting, an empty value removes KEY (repeatable)" value-name:"KEY=VALUE"`
+}
+
+func (cmd *EditCommand) Execute(args []string) error {
+	profile, err := keychain.LoadProfile(cmd.Profile)
+	if err != nil {
+		return errors.Wrap(err, "load profile")
+	}
+
+	interactive := len(cmd.Set) == 0 && !cmd.MetaOptions.given()
+	if interactive {
+		if err := editProfile(profile); err != nil {
+			return err
+		}
+	}
+	for _, assignment := range cmd.Set {
+		name, value, err := parseAssignment(assignment)
+		if err != nil {
+			return err
+		}
+		profile.Set(name, value)
+	}
+	cmd.apply(profile)
+
+	if err := restic.ValidateEnv(profile.Vars()); err != nil {
+		return errors.Wrap(err, "invalid profile")
+	}
+
+	initialized, err := cmd.verifyProfile(cmd.Profile, profile, interactive && term.IsTerminal(int(os.Stdin.Fd())))
+	if err != nil {
+		return err
+	}
+	if initialized {
+		fmt.Println("Repository initialized.")
+	}
+
+	if err := keychain.UpdateProfile(cmd.Profile, profile); err != nil {
+		return errors.Wrap(err, "update profile")
+	}
+
+	fmt.Printf("Profile '%s' updated successfully.\n", cmd.Profile)
+	return nil
+}
+
+// parseAssignment splits a KEY=VALUE argument.
+func parseAssignment(assignment string) (string, string, error) {
+	name, value, found := strings.Cut(assignment, "=")
+	name = strings.TrimSpace(name)
+	if !found || name == "" {
+		return "", "", fmt.Errorf("expected KEY=VALUE, got %q", assignment)
+	}
+	return name, value, nil
+}
+
+// editProfile prompts for the repository and password, the variables of the
+// repository's backend and every other variable already in the profile, then
+// for new variables.
+func editProfile(profile *keychain.Profile) error {
+	fmt.Println("Press enter to keep a value. Clear a value, or enter - for a secret, to remove an optional variable.")
+
+	existing := profile.Names()
+	seen := map[string]bool{}
+
+	edit := func(v restic.EnvVar) error {
+		seen[v.Name] = true
+		value, err := promptVar(v, profile.Get(v.Name))
+		if err != nil {
+			return errors.Wrapf(err, "edit %s", v.Name)
+		}
+		profile.Set(v.Name, value)
+		return nil
+	}
+
+	for _, name := range []string{"RESTIC_REPOSITORY", "RESTIC_PASSWORD"} {
+		v, _ := restic.LookupEnvVar(name)
+		if err := edit(v); err != nil {
+			return err
+		}
+	}
+
+	// the backend may have changed along with the repository
+	if loc, err := restic.ParseRepository(profile.ResticRepository); err == nil {
+		for _, v := range restic.BackendEnvVars(loc.Backend) {
+			if err := edit(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range existing {
+		if seen[name] {
+			continue
+		}
+		v, ok := restic.LookupEnvVar(name)
+		if !ok {
+			v = restic.EnvVar{Name: name, Secret: restic.IsSecretEnvVar(name)}
+		}
+		if err := edit(v); err != nil {
+			return err
+		}
+	}
+
+	return readExtraVars(profile)
+}
+
+// promptVar prompts for a new value of v. Plain values are prefilled with
+// current. Secrets are never shown: an empty answer keeps current and "-"
+// removes it.
+func promptVar(v restic.EnvVar, current string) (string, error) {
+	line := liner.NewLiner()
+	defer line.Close()
+
+	line.SetCtrlCAborts(true)
+
+	for {
+		var value string
+		var err error
+		if v.Secret {
+			hint := "unset"
+			if current != "" {
+				hint = "unchanged"
+			}
+			value, err = line.PasswordPrompt(fmt.Sprintf("(secret, %s) %s=", hint, v.Name))
+			if err == nil {
+				switch value {
+				case "":
+					value = current
+				case "-":
+					value = ""
+				}
+			}
+		} else {
+			value, err = line.PromptWithSuggestion(v.Name+"=", current, -1)
+		}
+
+		if err != nil {
+			return "", errors.Wrap(err, "get line")
+		}
+
+		if value != "" || !v.Required {
+			return value, nil
+		}
+
+		fmt.Printf("%s is required\n", v.Name)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+type ExecCommand struct {
+	Profiles  []string `short:"p" long:"profile" description:"Profile to run the command with, repeat to run it against each profile in turn" required:"true"`
+	KeepGoing bool     `short:"k" long:"keep-going" description:"Run the command for the remaining profiles after a failure"`
+}
+
+func (cmd *ExecCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no command given, usage: exec -p profile -- command [args...]")
+	}
+
+	exitCode := 0
+	for _, profile := range cmd.Profiles {
+		if len(cmd.Profiles) > 1 {
+			fmt.Fprintf(os.Stderr, "==> %s\n", profile)
+		}
+
+		env, err := profileEnv(profile)
+		if err != nil {
+			return errors.Wrapf(err, "profile %s", profile)
+		}
+
+		code, err := runWithSignals(args, env)
+		if err != nil {
+			return errors.Wrapf(err, "profile %s", profile)
+		}
+
+		if code != 0 {
+			exitCode = code
+			if !cmd.KeepGoing {
+				break
+			}
+		}
+	}
+
+	os.Exit(exitCode)
+	return nil
+}
+
+// runWithSignals runs args with env, forwarding SIGTERM and SIGHUP to the
+// child. The child shares the terminal's foreground process group and gets
+// Ctrl-C and Ctrl-\ from the terminal itself, so SIGINT and SIGQUIT are only
+// kept from killing the CLI: delivering them twice would make restic abort
+// its cleanup and leave a stale lock. It returns the child's exit code, or
+// 128 plus the signal number if the child was killed by a signal, as shells
+// do.
+func runWithSignals(args []string, env []string) (int, error) {
+	c := exec.Command(args[0], args[1:]...)
+	c.Env = env
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	// signal.Ignore would be inherited by the child, a handler isn't
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	if err := c.Start(); err != nil {
+		return 0, errors.Wrap(err, "start command")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGTERM || sig == syscall.SIGHUP {
+					_ = c.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := c.Wait()
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, errors.Wrap(err, "wait for command")
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return exitErr.ExitCode(), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComposeEnv(t *testing.T) {
+	t.Setenv("BACKUP_TEST_SECRET", "from-env")
+
+	env, err := composeEnv([]string{
+		"HOME=/home/alice",
+		"AWS_PROFILE=work",
+		"AWS_SECRET_ACCESS_KEY=inherited",
+		"RESTIC_PASSWORD_FILE=/etc/restic-pw",
+		"RESTIC_REPOSITORY=/srv/other",
+	}, &keychain.Profile{
+		ResticRepository: "s3:s3.amazonaws.com/bucket",
+		ResticPassword:   "env:BACKUP_TEST_SECRET",
+		Env:              map[string]string{"AWS_DEFAULT_REGION": "eu-west-1"},
+	})
+	require.NoError(t, err)
+
+	// ambient settings are kept, inherited secrets and restic settings are
+	// replaced by the profile's
+	assert.Equal(t, []string{
+		"HOME=/home/alice",
+		"AWS_PROFILE=work",
+		"AWS_DEFAULT_REGION=eu-west-1",
+		"RESTIC_PASSWORD=from-env",
+		"RESTIC_REPOSITORY=s3:s3.amazonaws.com/bucket",
+	}, env)
+}
+
+func TestRunWithSignals(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "child")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+trap 'exit 7' INT
+trap 'exit 9' TERM
+case "$1" in
+exit) exit 3 ;;
+kill) kill -KILL $$ ;;
+wait) sleep 2 & wait ;;
+esac
+`), 0o755))
+
+	code, err := runWithSignals([]string{script, "exit"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, code)
+
+	code, err = runWithSignals([]string{script, "kill"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 128+int(syscall.SIGKILL), code)
+
+	signal := func(sig syscall.Signal) {
+		time.AfterFunc(300*time.Millisecond, func() {
+			_ = syscall.Kill(os.Getpid(), sig)
+		})
+	}
+
+	// Ctrl-C reaches the child from the terminal, it isn't sent again
+	signal(syscall.SIGINT)
+	code, err = runWithSignals([]string{script, "wait"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, code)
+
+	signal(syscall.SIGTERM)
+	code, err = runWithSignals([]string{script, "wait"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 9, code)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/minor-industries/backup/restic"
+	"github.com/minor-industries/backup/secrets"
+	"github.com/pkg/errors"
+)
+
+type KeyCommand struct{}
+
+type KeyListCommand struct {
+	RepositoryOptions
+	JSON bool `long:"json" description:"Print the keys as a JSON array"`
+}
+
+func (cmd *KeyListCommand) Execute(args []string) error {
+	opts, target, err := cmd.target()
+	if err != nil {
+		return err
+	}
+
+	keys, err := restic.KeyList(opts, target)
+	if err != nil {
+		return errors.Wrap(err, "list keys")
+	}
+
+	if cmd.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(keys), "encode keys")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, " \tID\tUSER\tHOST\tCREATED")
+	for _, key := range keys {
+		current := " "
+		if key.Current {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", current, key.ID, key.UserName, key.HostName, key.Created)
+	}
+	return w.Flush()
+}
+
+type KeyAddCommand struct {
+	RepositoryOptions
+	Host        string `long:"host" description:"Host name recorded in the key (default: this host)"`
+	User        string `long:"user" description:"User name recorded in the key (default: this user)"`
+	NewPassword string `long:"new-password" description:"Secret reference to read the new key's password from instead of prompting" value-name:"REF"`
+}
+
+func (cmd *KeyAddCommand) Execute(args []string) error {
+	opts, target, err := cmd.target()
+	if err != nil {
+		return err
+	}
+
+	password, err := readSecret(cmd.NewPassword, "--new-password", "New key password", true)
+	if err != nil {
+		return err
+	}
+
+	err = restic.KeyAdd(opts, target, restic.KeyAddOptions{
+		NewPassword: password,
+		Host:        cmd.Host,
+		User:        cmd.User,
+	})
+	if err != nil {
+		return errors.Wrap(err, "add key")
+	}
+
+	fmt.Println("Key added.")
+	return nil
+}
+
+type KeyRemoveCommand struct {
+	RepositoryOptions
+	Args struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (cmd *KeyRemoveCommand) Execute(args []string) error {
+	opts, target, err := cmd.target()
+	if err != nil {
+		return err
+	}
+
+	if err := restic.KeyRemove(opts, target, cmd.Args.ID); err != nil {
+		return errors.Wrap(err, "remove key")
+	}
+
+	fmt.Printf("Key %s removed.\n", cmd.Args.ID)
+	return nil
+}
+
+type KeyPasswdCommand struct {
+	RepositoryOptions
+	NewPassword string `long:"new-password" description:"Secret reference to read the new password from instead of prompting" value-name:"REF"`
+}
+
+// Execute changes the password of the profile's key and stores the new
+// password in the profile. A password held in a secret reference has to be
+// updated where the reference points.
+func (cmd *KeyPasswdCommand) Execute(args []string) error {
+	profile, err := keychain.LoadProfile(cmd.Profile)
+	if err != nil {
+		return errors.Wrap(err, "load profile")
+	}
+	target := restic.ProfileTarget(cmd.Profile, profile)
+
+	password, err := readSecret(cmd.NewPassword, "--new-password", "New password", true)
+	if err != nil {
+		return err
+	}
+
+	if err := restic.KeyPasswd(cmd.config(), &target, password); err != nil {
+		return errors.Wrap(err, "change password")
+	}
+
+	if secrets.IsReference(profile.ResticPassword) {
+		fmt.Printf("Password changed. Update %s to the new password.\n", profile.ResticPassword)
+		return nil
+	}
+
+	profile.ResticPassword = password
+	if err := keychain.UpdateProfile(cmd.Profile, profile); err != nil {
+		return errors.Wrap(err, "password changed but profile not updated")
+	}
+
+	fmt.Printf("Password changed and profile '%s' updated.\n", cmd.Profile)
+	return nil
+}
+
+type RotatePasswordCommand struct {
+	RepositoryOptions
+	Prompt      bool   `long:"prompt" description:"Prompt for the new password instead of generating one"`
+	NewPassword string `long:"new-password" description:"Secret reference to read the new password from instead of generating one" value-name:"REF"`
+}
+
+// Execute replaces the profile's repository key with a key for a new
+// password and stores that password in the profile, rolling back if any
+// step fails.
+func (cmd *RotatePasswordCommand) Execute(args []string) error {
+	profile, err := keychain.LoadProfile(cmd.Profile)
+	if err != nil {
+		return errors.Wrap(err, "load profile")
+	}
+	if secrets.IsReference(profile.ResticPassword) {
+		return fmt.Errorf("the password of profile %s is the reference %s, which can't be updated", cmd.Profile, profile.ResticPassword)
+	}
+	target := restic.ProfileTarget(cmd.Profile, profile)
+
+	var password string
+	if cmd.Prompt || cmd.NewPassword != "" {
+		password, err = readSecret(cmd.NewPassword, "--new-password", "New password", true)
+	} else {
+		password, err = generatePassword()
+	}
+	if err != nil {
+		return err
+	}
+
+	rotation, err := restic.RotatePassword(cmd.config(), &target, password, func(password string) error {
+		profile.ResticPassword = password
+		return keychain.UpdateProfile(cmd.Profile, profile)
+	})
+	if err != nil {
+		return errors.Wrap(err, "rotate password")
+	}
+
+	if rotation.Warning != "" {
+		fmt.Printf("Rotated the password of profile '%s' to key %s.\n", cmd.Profile, rotation.NewKeyID)
+		fmt.Fprintf(os.Stderr, "warning: %s\n", rotation.Warning)
+		return nil
+	}
+
+	fmt.Printf("Rotated the password of profile '%s': added key %s, removed key %s.\n",
+		cmd.Profile, rotation.NewKeyID, rotation.OldKeyID)
+	return nil
+}
+
+// generatePassword returns a random password with 256 bits of entropy.
+func generatePassword() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", errors.Wrap(err, "generate password")
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
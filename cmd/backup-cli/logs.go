@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/minor-industries/backup/eventlog"
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+)
+
+type LogsCommand struct {
+	Config   string `short:"c" long:"config" description:"Path to the backup config file (for state_dir)"`
+	StateDir string `long:"state-dir" description:"State directory containing the run logs"`
+	Follow   bool   `short:"f" long:"follow" description:"Wait for new events until the run is done"`
+	Raw      bool   `long:"raw" description:"Print the raw JSON lines"`
+	Args     struct {
+		RunID string `positional-arg-name:"run-id" description:"Run to show; lists runs when omitted, \"latest\" for the newest"`
+	} `positional-args:"true"`
+}
+
+func (cmd *LogsCommand) Execute(args []string) error {
+	dir, err := cmd.logDir()
+	if err != nil {
+		return err
+	}
+
+	runs, err := eventlog.Runs(dir)
+	if err != nil {
+		return errors.Wrap(err, "list runs")
+	}
+
+	runID := cmd.Args.RunID
+	if runID == "" {
+		if len(runs) == 0 {
+			fmt.Println("No runs found.")
+		}
+		for _, run := range runs {
+			fmt.Printf("%s  %s  %s\n",
+				run.ID,
+				run.ModTime.Local().Format(time.RFC3339),
+				restic.FormatBytes(run.Size),
+			)
+		}
+		return nil
+	}
+
+	if runID == "latest" {
+		if len(runs) == 0 {
+			return errors.New("no runs found")
+		}
+		runID = runs[len(runs)-1].ID
+	}
+
+	return eventlog.Read(dir, runID, cmd.Follow, func(line []byte, env restic.Envelope) error {
+		if cmd.Raw {
+			fmt.Println(string(line))
+			return nil
+		}
+
+		return restic.Dispatch(restic.Log(func(msg string) error {
+			fmt.Printf("%s %s\n", env.Time.Local().Format(time.DateTime), msg)
+			return nil
+		}), env)
+	})
+}
+
+func (cmd *LogsCommand) logDir() (string, error) {
+	if cmd.StateDir != "" {
+		return eventlog.Dir(cmd.StateDir), nil
+	}
+
+	if cmd.Config != "" {
+		opts, err := cfg.Load(cmd.Config)
+		if err != nil {
+			return "", errors.Wrap(err, "load config")
+		}
+		stateDir, err := opts.StateDirectory()
+		if err != nil {
+			return "", errors.Wrap(err, "get state dir")
+		}
+		return eventlog.Dir(stateDir), nil
+	}
+
+	stateDir, err := cfg.DefaultStateDir()
+	if err != nil {
+		return "", errors.Wrap(err, "get state dir")
+	}
+	return eventlog.Dir(stateDir), nil
+}
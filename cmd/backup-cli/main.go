@@ -15,10 +15,32 @@ func main() {
 	}
 
 	must(parser.AddCommand("new", "Create a new profile", "Creates a new profile", &NewCommand{}))
-	must(parser.AddCommand("list", "List profiles", "Lists all profiles", &ListCommand{}))
+	must(parser.AddCommand("list", "List profiles", "Lists all profiles with their repository and metadata", &ListCommand{}))
 	must(parser.AddCommand("shell", "Open shell for profile", "Opens a shell with the selected profile", &ShellCommand{}))
+	must(parser.AddCommand("exec", "Run a command with profiles", "Runs a command with the environment of each given profile in turn, e.g. exec -p nas -- restic snapshots", &ExecCommand{}))
 	must(parser.AddCommand("edit", "Edit a profile", "Edits the selected profile", &EditCommand{}))
+	must(parser.AddCommand("rename", "Rename a profile", "Stores a profile under a new name", &RenameCommand{}))
+	must(parser.AddCommand("copy", "Copy a profile", "Stores a copy of a profile under a new name", &CopyCommand{}))
 	must(parser.AddCommand("delete", "Delete a profile", "Deletes the selected profile", &DeleteCommand{}))
+	must(parser.AddCommand("export", "Export profiles", "Writes the selected profiles to a passphrase-encrypted bundle", &ExportCommand{}))
+	must(parser.AddCommand("import", "Import profiles", "Restores the profiles of an encrypted bundle", &ImportCommand{}))
+	must(parser.AddCommand("backup", "Run a backup", "Backs up the given paths to every configured target", &BackupCommand{}))
+	must(parser.AddCommand("logs", "Show run logs", "Lists logged runs or shows the events of one run", &LogsCommand{}))
+	must(parser.AddCommand("status", "Show backup freshness", "Reports the latest snapshot, size and snapshot count of every configured target", &StatusCommand{}))
+	must(parser.AddCommand("compare", "Compare snapshots across targets", "Matches the snapshots of every configured target by time, tree and tags and reports gaps and targets that have fallen behind", &CompareCommand{}))
+	must(parser.AddCommand("diff", "Show what changed between snapshots", "Lists the paths that changed between two snapshots of a profile's repository, by default the latest snapshot and its parent", &DiffCommand{}))
+
+	profiles, err := parser.AddCommand("profiles", "Manage stored profiles", "Maintenance commands for the stored profiles", &ProfilesCommand{})
+	must(profiles, err)
+	must(profiles.AddCommand("migrate", "Migrate profiles", "Upgrades all stored profiles to the current format and reports what changed", &MigrateCommand{}))
+
+	key, err := parser.AddCommand("key", "Manage repository keys", "Lists, adds and removes the keys of a profile's repository", &KeyCommand{})
+	must(key, err)
+	must(key.AddCommand("list", "List keys", "Lists the keys of the repository", &KeyListCommand{}))
+	must(key.AddCommand("add", "Add a key", "Adds a key with a new password, e.g. for another person", &KeyAddCommand{}))
+	must(key.AddCommand("remove", "Remove a key", "Removes the key with the given id", &KeyRemoveCommand{}))
+	must(key.AddCommand("passwd", "Change the password", "Changes the password of the profile's key and updates the profile", &KeyPasswdCommand{}))
+	must(parser.AddCommand("rotate-password", "Rotate a repository password", "Replaces the profile's key with a key for a new password, updating the profile and rolling back on failure", &RotatePasswordCommand{}))
 
 	if _, err := parser.Parse(); err != nil {
 		os.Exit(1)
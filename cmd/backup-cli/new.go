@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"golang.org/x/term"
+)
+
+type NewCommand struct {
+	ProfileOptions
+	VerifyOptions
+	MetaOptions
+	Set      []string `long:"set" description:"Set KEY=VALUE (repeatable), applied after --from-file" value-name:"KEY=VALUE"`
+	FromFile string   `long:"from-file" description:"Read variables from a JSON object or dotenv file, - for stdin" value-name:"PATH"`
+	Force    bool     `long:"force" description:"Replace the profile if it already exists"`
+	JSON     bool     `long:"json" description:"Print the result as a JSON object"`
+}
+
+// newResult is printed by new --json.
+type newResult struct {
+	Profile     string         `json:"profile"`
+	OK          bool           `json:"ok"`
+	Replaced    bool           `json:"replaced,omitempty"`
+	Vars        []string       `json:"vars,omitempty"`
+	Verified    bool           `json:"verified,omitempty"`
+	Initialized bool           `json:"initialized,omitempty"`
+	Failure     restic.Failure `json:"failure,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+func (cmd *NewCommand) Execute(args []string) error {
+	result := newResult{Profile: cmd.Profile}
+
+	err := cmd.create(&result)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.OK = true
+	}
+
+	if cmd.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(result); encErr != nil && err == nil {
+			err = errors.Wrap(encErr, "encode result")
+		}
+	} else if err == nil {
+		if result.Initialized {
+			fmt.Println("Repository initialized.")
+		}
+		if result.Replaced {
+			fmt.Printf("Profile '%s' replaced successfully.\n", cmd.Profile)
+		} else {
+			fmt.Printf("Profile '%s' created successfully.\n", cmd.Profile)
+		}
+	}
+
+	return err
+}
+
+func (cmd *NewCommand) create(result *newResult) error {
+	existing, err := keychain.ListProfiles()
+	if err != nil {
+		return errors.Wrap(err, "list profiles")
+	}
+	exists := lo.Contains(existing, cmd.Profile)
+	if exists && !cmd.Force {
+		return fmt.Errorf("profile %s already exists, use --force to replace it", cmd.Profile)
+	}
+
+	profile, err := cmd.readProfile()
+	if err != nil {
+		return err
+	}
+
+	if err := restic.ValidateEnv(profile.Vars()); err != nil {
+		return errors.Wrap(err, "invalid profile")
+	}
+	cmd.apply(profile)
+
+	result.Initialized, err = cmd.verifyProfile(cmd.Profile, profile, term.IsTerminal(int(os.Stdin.Fd())) && !cmd.JSON)
+	if err != nil {
+		var verifyErr *restic.VerifyError
+		if errors.As(err, &verifyErr) {
+			result.Failure = verifyErr.Failure
+		}
+		return err
+	}
+	result.Verified = cmd.Verify
+
+	if exists {
+		err = keychain.UpdateProfile(cmd.Profile, profile)
+	} else {
+		err = keychain.NewProfile(cmd.Profile, profile)
+	}
+	if err != nil {
+		return errors.Wrap(err, "save profile")
+	}
+
+	result.Replaced = exists
+	result.Vars = profile.Names()
+	return nil
+}
+
+// readProfile takes the profile from --from-file and --set, from stdin when
+// neither is given and stdin isn't a terminal, or else from prompts.
+func (cmd *NewCommand) readProfile() (*keychain.Profile, error) {
+	fromFile := cmd.FromFile
+	if fromFile == "" && len(cmd.Set) == 0 {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			return promptProfile()
+		}
+		fromFile = "-"
+	}
+
+	profile := &keychain.Profile{}
+	if fromFile != "" {
+		var data []byte
+		var err error
+		if fromFile == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(fromFile)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read profile")
+		}
+
+		profile, err = keychain.ParseProfile(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, assignment := range cmd.Set {
+		name, value, err := parseAssignment(assignment)
+		if err != nil {
+			return nil, err
+		}
+		profile.Set(name, value)
+	}
+
+	return profile, nil
+}
+
+func promptProfile() (*keychain.Profile, error) {
+	fmt.Println("new profile")
+
+	profile := &keychain.Profile{}
+
+	for _, name := range []string{"RESTIC_REPOSITORY", "RESTIC_PASSWORD"} {
+		v, _ := restic.LookupEnvVar(name)
+		value, err := readRequiredVar(v)
+		if err != nil {
+			return nil, err
+		}
+		profile.Set(name, value)
+	}
+
+	loc, err := restic.ParseRepository(profile.ResticRepository)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse repository")
+	}
+
+	backendVars := restic.BackendEnvVars(loc.Backend)
+	if len(backendVars) > 0 {
+		fmt.Printf("%s backend credentials\n", loc.Backend)
+	}
+	for _, v := range backendVars {
+		value, err := readRequiredVar(v)
+		if err != nil {
+			return nil, err
+		}
+		profile.Set(v.Name, value)
+	}
+
+	if err := readExtraVars(profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+)
+
+type MetaOptions struct {
+	Description string   `long:"description" description:"Description of the profile"`
+	Labels      []string `long:"label" description:"Label of the profile, replaces all labels (repeatable)"`
+}
+
+// apply sets the metadata given on the command line.
+func (o *MetaOptions) apply(profile *keychain.Profile) {
+	if o.Description != "" {
+		profile.Meta.Description = o.Description
+	}
+	if len(o.Labels) > 0 {
+		profile.Meta.Labels = o.Labels
+	}
+}
+
+func (o *MetaOptions) given() bool {
+	return o.Description != "" || len(o.Labels) > 0
+}
+
+type ListCommand struct {
+	JSON bool `long:"json" description:"Print the profiles as a JSON array"`
+}
+
+// profileInfo is a row of list, and an element of list --json.
+type profileInfo struct {
+	Name        string     `json:"name"`
+	Repository  string     `json:"repository,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Labels      []string   `json:"labels,omitempty"`
+	Created     *time.Time `json:"created,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+func (cmd *ListCommand) Execute(args []string) error {
+	names, err := keychain.ListProfiles()
+	if err != nil {
+		return errors.Wrap(err, "list profiles")
+	}
+	sort.Strings(names)
+
+	infos := make([]profileInfo, 0, len(names))
+	for _, name := range names {
+		infos = append(infos, loadProfileInfo(name))
+	}
+
+	if cmd.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(infos), "encode profiles")
+	}
+
+	if len(infos) == 0 {
+		fmt.Println("No profiles found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREPOSITORY\tLABELS\tUPDATED\tLAST SUCCESS\tDESCRIPTION")
+	for _, info := range infos {
+		if info.Error != "" {
+			fmt.Fprintf(w, "%s\terror: %s\t\t\t\t\n", info.Name, info.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			info.Name,
+			info.Repository,
+			strings.Join(info.Labels, ","),
+			formatTime(info.Updated),
+			formatTime(info.LastSuccess),
+			info.Description,
+		)
+	}
+	return w.Flush()
+}
+
+func loadProfileInfo(name string) profileInfo {
+	info := profileInfo{Name: name}
+
+	profile, err := keychain.LoadProfile(name)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	// a repository that can't be parsed may contain anything, don't show it
+	if masked, err := restic.MaskRepository(profile.ResticRepository); err == nil {
+		info.Repository = masked
+	}
+	info.Description = profile.Meta.Description
+	info.Labels = profile.Meta.Labels
+	info.Created = profile.Meta.Created
+	info.Updated = profile.Meta.Updated
+	info.LastSuccess = profile.Meta.LastSuccess
+	return info
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+type RenameCommand struct {
+	Args struct {
+		Old string `positional-arg-name:"old" required:"true"`
+		New string `positional-arg-name:"new" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (cmd *RenameCommand) Execute(args []string) error {
+	if err := keychain.RenameProfile(cmd.Args.Old, cmd.Args.New); err != nil {
+		return errors.Wrap(err, "rename profile")
+	}
+
+	fmt.Printf("Profile '%s' renamed to '%s'.\n", cmd.Args.Old, cmd.Args.New)
+	return nil
+}
+
+type CopyCommand struct {
+	Args struct {
+		Source      string `positional-arg-name:"source" required:"true"`
+		Destination string `positional-arg-name:"destination" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (cmd *CopyCommand) Execute(args []string) error {
+	if err := keychain.CopyProfile(cmd.Args.Source, cmd.Args.Destination); err != nil {
+		return errors.Wrap(err, "copy profile")
+	}
+
+	fmt.Printf("Profile '%s' copied to '%s'.\n", cmd.Args.Source, cmd.Args.Destination)
+	return nil
+}
+
+type ProfilesCommand struct{}
+
+type MigrateCommand struct {
+	DryRun bool `long:"dry-run" description:"Only report what would change"`
+}
+
+func (cmd *MigrateCommand) Execute(args []string) error {
+	names, err := keychain.ListProfiles()
+	if err != nil {
+		return errors.Wrap(err, "list profiles")
+	}
+	sort.Strings(names)
+
+	var failed int
+	for _, name := range names {
+		result, err := keychain.MigrateProfile(name, cmd.DryRun)
+		if err != nil {
+			failed++
+			fmt.Printf("%s: error: %s\n", name, err)
+			continue
+		}
+
+		if len(result.Changes) == 0 {
+			fmt.Printf("%s: up to date (v%d)\n", name, result.To)
+			continue
+		}
+
+		verb := "migrated"
+		if cmd.DryRun {
+			verb = "would migrate"
+		}
+		fmt.Printf("%s: %s v%d -> v%d\n", name, verb, result.From, result.To)
+		for _, change := range result.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d profiles failed to migrate", failed, len(names))
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+)
+
+type ShellCommand struct {
+	ProfileOptions
+	Nested bool `long:"nested" description:"Allow opening a profile shell from within another one"`
+}
+
+// The prompt snippets refer to $BACKUP_PROFILE instead of embedding the name
+// so a profile name is never evaluated as shell code. Where the shell expands
+// the prompt when drawing it (bash, sh, and zsh with PROMPT_SUBST), the
+// reference itself goes into the prompt; the expanded value is not scanned
+// for command substitutions again.
+
+const bashRC = `[ -f /etc/bash.bashrc ] && . /etc/bash.bashrc
+[ -f ~/.bashrc ] && . ~/.bashrc
+PS1='[${BACKUP_PROFILE}] '"$PS1"
+`
+
+const zshEnv = `__backup_zdotdir=$ZDOTDIR
+ZDOTDIR=${BACKUP_ORIG_ZDOTDIR:-$HOME}
+[ -f "$ZDOTDIR/.zshenv" ] && . "$ZDOTDIR/.zshenv"
+BACKUP_ORIG_ZDOTDIR=$ZDOTDIR
+ZDOTDIR=$__backup_zdotdir
+unset __backup_zdotdir
+`
+
+const zshRC = `ZDOTDIR=${BACKUP_ORIG_ZDOTDIR:-$HOME}
+unset BACKUP_ORIG_ZDOTDIR
+[ -f "$ZDOTDIR/.zshrc" ] && . "$ZDOTDIR/.zshrc"
+if [[ -o prompt_subst ]]; then
+	PROMPT='[${BACKUP_PROFILE//\%/%%}] '"$PROMPT"
+else
+	PROMPT="[${BACKUP_PROFILE//\%/%%}] $PROMPT"
+fi
+`
+
+const fishInit = `functions -q fish_prompt; and functions -c fish_prompt __backup_fish_prompt
+function fish_prompt
+    echo -n "[$BACKUP_PROFILE] "
+    functions -q __backup_fish_prompt; and __backup_fish_prompt
+end`
+
+func (cmd *ShellCommand) Execute(args []string) error {
+	if current := os.Getenv("BACKUP_PROFILE"); current != "" && !cmd.Nested {
+		return fmt.Errorf("already in a shell for profile %s, exit it first or use --nested", current)
+	}
+
+	env, err := profileEnv(cmd.Profile)
+	if err != nil {
+		return err
+	}
+	env = append(env, "BACKUP_PROFILE="+cmd.Profile)
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	tmpDir, err := os.MkdirTemp("", "backup-shell-")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	shellArgs, env, err := promptSetup(shell, env, tmpDir)
+	if err != nil {
+		return errors.Wrap(err, "set up prompt")
+	}
+
+	masked, err := restic.MaskRepository(lookupEnv(env, "RESTIC_REPOSITORY"))
+	if err != nil {
+		return errors.Wrap(err, "mask repo password")
+	}
+
+	fmt.Fprintf(os.Stderr, "Entering shell for profile %s (repository %s)\n", cmd.Profile, masked)
+	code, err := runWithSignals(shellArgs, env)
+	if err != nil {
+		return errors.Wrap(err, "run shell")
+	}
+	fmt.Fprintf(os.Stderr, "Leaving shell for profile %s (repository %s)\n", cmd.Profile, masked)
+
+	os.RemoveAll(tmpDir)
+	os.Exit(code)
+	return nil
+}
+
+// promptSetup returns the command line that starts shell with the profile
+// name in its prompt, and the environment to start it with. Startup files
+// that wrap the user's own are written to tmpDir.
+func promptSetup(shell string, env []string, tmpDir string) ([]string, []string, error) {
+	switch filepath.Base(shell) {
+	case "bash":
+		rcfile := filepath.Join(tmpDir, "bashrc")
+		if err := os.WriteFile(rcfile, []byte(bashRC), 0o600); err != nil {
+			return nil, nil, err
+		}
+		return []string{shell, "--rcfile", rcfile, "-i"}, env, nil
+
+	case "zsh":
+		files := map[string]string{".zshenv": zshEnv, ".zshrc": zshRC}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600); err != nil {
+				return nil, nil, err
+			}
+		}
+		env = append(env,
+			"BACKUP_ORIG_ZDOTDIR="+lookupEnv(env, "ZDOTDIR"),
+			"ZDOTDIR="+tmpDir,
+		)
+		return []string{shell, "-i"}, env, nil
+
+	case "fish":
+		return []string{shell, "--init-command", fishInit}, env, nil
+
+	default:
+		// a plain sh takes its prompt from the environment and expands
+		// parameters in it
+		ps1 := lookupEnv(env, "PS1")
+		if ps1 == "" {
+			ps1 = "$ "
+		}
+		return []string{shell, "-i"}, append(env, "PS1=[${BACKUP_PROFILE}] "+ps1), nil
+	}
+}
+
+// lookupEnv returns the last value of name in env, like exec.Cmd does.
+func lookupEnv(env []string, name string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if value, found := strings.CutPrefix(env[i], name+"="); found {
+			return value
+		}
+	}
+	return ""
+}
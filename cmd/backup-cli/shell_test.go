@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// evilProfile would run a command if it were ever evaluated as shell code.
+const evilProfile = "$(touch pwned)`touch pwned`"
+
+func TestPromptSetup(t *testing.T) {
+	env := []string{"HOME=/home/alice", "ZDOTDIR=/home/alice/.config/zsh", "BACKUP_PROFILE=" + evilProfile}
+
+	dir := t.TempDir()
+	args, result, err := promptSetup("/bin/bash", env, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/bin/bash", "--rcfile", filepath.Join(dir, "bashrc"), "-i"}, args)
+	assert.Equal(t, env, result)
+	rc, err := os.ReadFile(filepath.Join(dir, "bashrc"))
+	require.NoError(t, err)
+	assert.Equal(t, bashRC, string(rc))
+
+	dir = t.TempDir()
+	args, result, err = promptSetup("/usr/bin/zsh", env, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/usr/bin/zsh", "-i"}, args)
+	assert.Equal(t, dir, lookupEnv(result, "ZDOTDIR"))
+	assert.Equal(t, "/home/alice/.config/zsh", lookupEnv(result, "BACKUP_ORIG_ZDOTDIR"))
+	assert.FileExists(t, filepath.Join(dir, ".zshenv"))
+	assert.FileExists(t, filepath.Join(dir, ".zshrc"))
+
+	args, _, err = promptSetup("/usr/local/bin/fish", env, t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/usr/local/bin/fish", "--init-command", fishInit}, args)
+
+	args, result, err = promptSetup("/bin/sh", env, t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-i"}, args)
+	assert.Equal(t, "[${BACKUP_PROFILE}] $ ", lookupEnv(result, "PS1"))
+
+	// none of the snippets contain the profile name itself
+	for _, snippet := range []string{bashRC, zshEnv, zshRC, fishInit, lookupEnv(result, "PS1")} {
+		assert.NotContains(t, snippet, evilProfile)
+	}
+}
+
+func TestPromptSetupDoesNotRunName(t *testing.T) {
+	tests := []struct {
+		name  string
+		shell string
+		zshrc string
+	}{
+		{name: "sh", shell: "sh"},
+		{name: "bash", shell: "bash"},
+		{name: "zsh", shell: "zsh"},
+		{name: "zsh prompt_subst", shell: "zsh", zshrc: "setopt prompt_subst\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shell, err := exec.LookPath(test.shell)
+			if err != nil {
+				t.Skipf("%s not installed", test.shell)
+			}
+
+			dir := t.TempDir()
+			home := filepath.Join(dir, "home")
+			require.NoError(t, os.Mkdir(home, 0o755))
+			if test.zshrc != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(home, ".zshrc"), []byte(test.zshrc), 0o600))
+			}
+
+			env := []string{
+				"PATH=" + os.Getenv("PATH"),
+				"HOME=" + home,
+				"PS1=$ ",
+				// keeps readline from scrolling a long prompt
+				"COLUMNS=500",
+				"BACKUP_PROFILE=" + evilProfile,
+			}
+			args, env, err := promptSetup(shell, env, t.TempDir())
+			require.NoError(t, err)
+
+			// an interactive shell prints its prompt to stderr
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Env = env
+			cmd.Dir = dir
+			cmd.Stdin = strings.NewReader("exit\n")
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+
+			assert.Contains(t, string(out), "["+evilProfile+"] ")
+			assert.NoFileExists(t, filepath.Join(dir, "pwned"))
+		})
+	}
+}
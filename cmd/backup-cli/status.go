@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+)
+
+// monitoring-plugin exit codes
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+type ConfigOptions struct {
+	Config string `short:"c" long:"config" description:"Path to the backup config file" required:"true"`
+}
+
+type StatusCommand struct {
+	ConfigOptions
+	MaxAge      time.Duration `long:"max-age" description:"Flag targets whose newest snapshot is older than this (overrides max_snapshot_age)"`
+	CriticalAge time.Duration `long:"critical-age" description:"Age at which a stale target is critical in --nagios mode (default: twice the max age)"`
+	Nagios      bool          `long:"nagios" description:"Print a monitoring-plugin status line and exit with OK/WARNING/CRITICAL"`
+}
+
+func (cmd *StatusCommand) Execute(args []string) error {
+	opts, err := cfg.Load(cmd.Config)
+	if err != nil {
+		if cmd.Nagios {
+			fmt.Printf("BACKUP UNKNOWN - %s\n", err)
+			os.Exit(nagiosUnknown)
+		}
+		return errors.Wrap(err, "load config")
+	}
+
+	maxAge := opts.MaxSnapshotAge
+	if cmd.MaxAge != 0 {
+		maxAge = cmd.MaxAge
+	}
+
+	now := time.Now()
+	results := restic.Status(opts, maxAge, now)
+
+	if cmd.Nagios {
+		criticalAge := cmd.CriticalAge
+		if criticalAge == 0 {
+			criticalAge = 2 * maxAge
+		}
+		os.Exit(printNagios(results, criticalAge, now))
+	}
+
+	for _, result := range results {
+		printStatus(&result, now)
+	}
+
+	return nil
+}
+
+func targetName(result *restic.TargetStatus) string {
+	if result.KeychainProfile != "" {
+		return fmt.Sprintf("profile %s", result.KeychainProfile)
+	}
+	return result.Repository
+}
+
+func printStatus(result *restic.TargetStatus, now time.Time) {
+	fmt.Println(targetName(result))
+
+	if result.Err != nil {
+		fmt.Printf("  error: %s\n", result.Err)
+		return
+	}
+
+	if result.Latest == nil {
+		fmt.Println("  latest snapshot: none")
+	} else {
+		fmt.Printf("  latest snapshot: %s (%s, %s ago)\n",
+			result.Latest.ShortID,
+			result.Latest.Time.Local().Format(time.RFC3339),
+			result.Age(now).Round(time.Second),
+		)
+	}
+
+	fmt.Printf("  snapshots: %d\n", result.SnapshotCount)
+	fmt.Printf("  size: %s\n", restic.FormatBytes(int64(result.TotalSize)))
+
+	if result.Stale {
+		fmt.Println("  STALE")
+	}
+}
+
+func printNagios(results []restic.TargetStatus, criticalAge time.Duration, now time.Time) int {
+	code := nagiosOK
+	var failed, stale int
+	var details []string
+
+	for _, result := range results {
+		name := targetName(&result)
+		switch {
+		case result.Err != nil:
+			failed++
+			code = nagiosCritical
+			details = append(details, fmt.Sprintf("%s: error: %s", name, result.Err))
+		case result.Latest == nil:
+			stale++
+			code = nagiosCritical
+			details = append(details, fmt.Sprintf("%s: no snapshots", name))
+		case result.Stale:
+			stale++
+			age := result.Age(now)
+			if criticalAge > 0 && age > criticalAge {
+				code = nagiosCritical
+			} else if code < nagiosWarning {
+				code = nagiosWarning
+			}
+			details = append(details, fmt.Sprintf("%s: latest snapshot %s old", name, age.Round(time.Second)))
+		default:
+			details = append(details, fmt.Sprintf("%s: latest snapshot %s old", name, result.Age(now).Round(time.Second)))
+		}
+	}
+
+	label := map[int]string{
+		nagiosOK:       "OK",
+		nagiosWarning:  "WARNING",
+		nagiosCritical: "CRITICAL",
+	}[code]
+
+	fmt.Printf("BACKUP %s - %d targets, %d stale, %d failed | targets=%d stale=%d failed=%d\n",
+		label, len(results), stale, failed, len(results), stale, failed)
+	for _, line := range details {
+		fmt.Println(line)
+	}
+
+	return code
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/backup/restic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintNagios(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fresh := restic.TargetStatus{Repository: "/srv/fresh", Latest: &restic.ResticSnapshot{Time: now.Add(-time.Hour)}}
+	stale := restic.TargetStatus{Repository: "/srv/stale", Latest: &restic.ResticSnapshot{Time: now.Add(-30 * time.Hour)}, Stale: true}
+	ancient := restic.TargetStatus{Repository: "/srv/ancient", Latest: &restic.ResticSnapshot{Time: now.Add(-72 * time.Hour)}, Stale: true}
+	empty := restic.TargetStatus{Repository: "/srv/empty", Stale: true}
+	failed := restic.TargetStatus{KeychainProfile: "nas", Err: errors.New("unreachable")}
+
+	tests := []struct {
+		name     string
+		results  []restic.TargetStatus
+		critical time.Duration
+		expected int
+	}{
+		{"all fresh", []restic.TargetStatus{fresh, fresh}, 48 * time.Hour, nagiosOK},
+		{"no targets", nil, 48 * time.Hour, nagiosOK},
+		{"stale", []restic.TargetStatus{fresh, stale}, 48 * time.Hour, nagiosWarning},
+		{"stale past critical age", []restic.TargetStatus{stale, ancient}, 48 * time.Hour, nagiosCritical},
+		{"stale without critical age", []restic.TargetStatus{ancient}, 0, nagiosWarning},
+		{"no snapshots", []restic.TargetStatus{fresh, empty}, 48 * time.Hour, nagiosCritical},
+		{"error", []restic.TargetStatus{failed, fresh}, 48 * time.Hour, nagiosCritical},
+		{"error outranks stale", []restic.TargetStatus{stale, failed}, 48 * time.Hour, nagiosCritical},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, printNagios(test.results, test.critical, now))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/minor-industries/backup/keychain"
+	"github.com/minor-industries/backup/restic"
+	"github.com/peterh/liner"
+	"github.com/pkg/errors"
+)
+
+type ResticOptions struct {
+	ResticPath string `long:"restic-path" description:"Path to the restic binary" default:"restic"`
+}
+
+func (o *ResticOptions) config() *cfg.BackupConfig {
+	return &cfg.BackupConfig{ResticPath: o.ResticPath}
+}
+
+type VerifyOptions struct {
+	ResticOptions
+	Verify bool `long:"verify" description:"Check that the repository can be opened before saving the profile"`
+	Init   bool `long:"init" description:"With --verify, initialize a missing repository without asking"`
+}
+
+// verifyProfile opens the profile's repository when --verify is given. A
+// missing repository is initialized with --init or after confirmation when
+// interactive. It reports whether the repository was initialized.
+func (o *VerifyOptions) verifyProfile(
+	profileName string,
+	profile *keychain.Profile,
+	interactive bool,
+) (bool, error) {
+	if !o.Verify {
+		return false, nil
+	}
+
+	opts := o.config()
+	target := restic.ProfileTarget(profileName, profile)
+
+	err := restic.Verify(opts, &target)
+	var verifyErr *restic.VerifyError
+	if !errors.As(err, &verifyErr) || verifyErr.Failure != restic.FailureRepoMissing {
+		return false, errors.Wrap(err, "verify")
+	}
+
+	if !o.Init {
+		if !interactive {
+			return false, errors.Wrap(err, "verify (use --init to create the repository)")
+		}
+
+		ok, confirmErr := confirm("Repository does not exist. Initialize it? [y/N] ")
+		if confirmErr != nil {
+			return false, confirmErr
+		}
+		if !ok {
+			return false, errors.Wrap(err, "verify")
+		}
+	}
+
+	if err := restic.InitRepo(opts, &target, nil); err != nil {
+		return false, errors.Wrap(err, "init repository")
+	}
+	return true, nil
+}
+
+func confirm(prompt string) (bool, error) {
+	line := liner.NewLiner()
+	defer line.Close()
+
+	line.SetCtrlCAborts(true)
+
+	answer, err := line.Prompt(prompt)
+	if err != nil {
+		return false, errors.Wrap(err, "get line")
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
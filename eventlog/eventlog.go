@@ -0,0 +1,247 @@
+package eventlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxSize = 10 * 1024 * 1024
+	defaultMaxAge  = 90 * 24 * time.Hour
+	fileSuffix     = ".jsonl"
+)
+
+// Writer appends every envelope it receives as a JSON line to a log file per
+// run. A run's log is continued in a numbered part once it grows beyond the
+// configured size.
+type Writer struct {
+	mu      sync.Mutex
+	dir     string
+	maxSize int64
+	runID   string
+	part    int
+	file    *os.File
+	size    int64
+}
+
+// Open creates dir if needed, removes logs older than the configured max age
+// and returns a Writer for new runs.
+func Open(dir string, opts cfg.EventLogConfig) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "create log dir")
+	}
+
+	maxAge := opts.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultMaxAge
+	}
+	if err := prune(dir, time.Now().Add(-maxAge)); err != nil {
+		return nil, errors.Wrap(err, "prune")
+	}
+
+	maxSize := opts.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultMaxSize
+	}
+
+	return &Writer{dir: dir, maxSize: maxSize}, nil
+}
+
+// Dir returns the directory run logs are kept in below stateDir.
+func Dir(stateDir string) string {
+	return filepath.Join(stateDir, "runs")
+}
+
+// Callback returns a callback for restic.Run that logs every message. Only
+// messages wrapped in a restic.Envelope are logged.
+func (w *Writer) Callback() func(msg any) error {
+	return func(msg any) error {
+		env, ok := msg.(restic.Envelope)
+		if !ok {
+			return nil
+		}
+		return w.Write(env)
+	}
+}
+
+func (w *Writer) Write(env restic.Envelope) error {
+	line, err := json.Marshal(env)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if env.RunID != w.runID {
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+		w.runID = env.RunID
+		w.part = 0
+	}
+
+	if w.file != nil && w.size+int64(len(line)) > w.maxSize {
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+		w.part++
+	}
+
+	if w.file == nil {
+		f, err := os.OpenFile(
+			filepath.Join(w.dir, partName(w.runID, w.part)),
+			os.O_WRONLY|os.O_CREATE|os.O_APPEND,
+			0o600,
+		)
+		if err != nil {
+			return errors.Wrap(err, "open log file")
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return errors.Wrap(err, "stat log file")
+		}
+		w.file = f
+		w.size = info.Size()
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	return errors.Wrap(err, "write log file")
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+func (w *Writer) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	w.size = 0
+	return errors.Wrap(err, "close log file")
+}
+
+func partName(runID string, part int) string {
+	if part == 0 {
+		return runID + fileSuffix
+	}
+	return fmt.Sprintf("%s.%d%s", runID, part, fileSuffix)
+}
+
+// parseName splits a log file name into its run id and part number.
+func parseName(name string) (string, int, bool) {
+	base, ok := strings.CutSuffix(name, fileSuffix)
+	if !ok {
+		return "", 0, false
+	}
+
+	if i := strings.LastIndexByte(base, '.'); i >= 0 {
+		part, err := strconv.Atoi(base[i+1:])
+		if err != nil {
+			return "", 0, false
+		}
+		return base[:i], part, true
+	}
+
+	return base, 0, true
+}
+
+type Run struct {
+	ID      string
+	Parts   []string
+	Size    int64
+	ModTime time.Time
+}
+
+// Runs lists the logged runs in dir, oldest first.
+func Runs(dir string) ([]Run, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read log dir")
+	}
+
+	type part struct {
+		path string
+		num  int
+	}
+
+	runs := map[string]*Run{}
+	parts := map[string][]part{}
+	for _, entry := range entries {
+		id, num, ok := parseName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, errors.Wrap(err, "stat log file")
+		}
+
+		r, ok := runs[id]
+		if !ok {
+			r = &Run{ID: id}
+			runs[id] = r
+		}
+		r.Size += info.Size()
+		if info.ModTime().After(r.ModTime) {
+			r.ModTime = info.ModTime()
+		}
+		parts[id] = append(parts[id], part{filepath.Join(dir, entry.Name()), num})
+	}
+
+	var result []Run
+	for id, r := range runs {
+		p := parts[id]
+		sort.Slice(p, func(i, j int) bool { return p[i].num < p[j].num })
+		for _, part := range p {
+			r.Parts = append(r.Parts, part.path)
+		}
+		result = append(result, *r)
+	}
+
+	// run ids start with their UTC start time
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// prune removes run logs whose newest part was last written before cutoff.
+func prune(dir string, cutoff time.Time) error {
+	runs, err := Runs(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range runs {
+		if !r.ModTime.Before(cutoff) {
+			continue
+		}
+		for _, path := range r.Parts {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "remove old log")
+			}
+		}
+	}
+
+	return nil
+}
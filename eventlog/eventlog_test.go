@@ -0,0 +1,124 @@
+package eventlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/minor-industries/backup/restic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := Open(dir, cfg.EventLogConfig{MaxSize: 300})
+	require.NoError(t, err)
+
+	meta := restic.Meta{RunID: "20260101T000000Z-0000", Target: "nas"}
+	messages := []any{
+		restic.StartBackup{Repository: "/repo"},
+		restic.ResticStatus{PercentDone: 0.5},
+		restic.StderrLine{Line: "warning"},
+		restic.ResticSummary{SnapshotID: "abcd"},
+		restic.RunDone{Outcome: restic.OutcomeSuccess},
+	}
+	for i, msg := range messages {
+		meta.Seq = uint64(i + 1)
+		err := w.Callback()(restic.Envelope{Meta: meta, Type: restic.MessageType(msg), Message: msg})
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	runs, err := Runs(dir)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, meta.RunID, runs[0].ID)
+	assert.Greater(t, len(runs[0].Parts), 1, "log should have been rotated")
+
+	var got []any
+	err = Read(dir, meta.RunID, true, func(line []byte, env restic.Envelope) error {
+		assert.Equal(t, "nas", env.Target)
+		got = append(got, env.Message)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, messages, got)
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+
+	old := filepath.Join(dir, "20200101T000000Z-0000.jsonl")
+	require.NoError(t, os.WriteFile(old, nil, 0o600))
+	require.NoError(t, os.Chtimes(old, time.Now(), time.Now().Add(-48*time.Hour)))
+
+	recent := filepath.Join(dir, "20260101T000000Z-0000.jsonl")
+	require.NoError(t, os.WriteFile(recent, nil, 0o600))
+
+	_, err := Open(dir, cfg.EventLogConfig{MaxAge: 24 * time.Hour})
+	require.NoError(t, err)
+
+	runs, err := Runs(dir)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "20260101T000000Z-0000", runs[0].ID)
+}
+
+func TestReadFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := Open(dir, cfg.EventLogConfig{MaxSize: 200})
+	require.NoError(t, err)
+
+	meta := restic.Meta{RunID: "20260101T000000Z-0000"}
+	write := func(msg any) {
+		meta.Seq++
+		require.NoError(t, w.Write(restic.Envelope{Meta: meta, Type: restic.MessageType(msg), Message: msg}))
+	}
+	write(restic.StartBackup{Repository: "/repo"})
+
+	// the writer keeps appending and rotating while the reader follows
+	go func() {
+		for i := 0; i < 20; i++ {
+			write(restic.StderrLine{Line: "line"})
+			time.Sleep(10 * time.Millisecond)
+		}
+		write(restic.RunDone{Outcome: restic.OutcomeSuccess})
+		w.Close()
+	}()
+
+	var seqs []uint64
+	err = Read(dir, meta.RunID, true, func(line []byte, env restic.Envelope) error {
+		seqs = append(seqs, env.Seq)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, seqs, 22)
+	for i, seq := range seqs {
+		assert.Equal(t, uint64(i+1), seq)
+	}
+}
+
+func TestReadStopsIdleRun(t *testing.T) {
+	dir := t.TempDir()
+
+	// a run that crashed before logging RunDone
+	path := filepath.Join(dir, "20260101T000000Z-0000.jsonl")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(-time.Hour)))
+
+	err := Read(dir, "20260101T000000Z-0000", true, func([]byte, restic.Envelope) error { return nil })
+	assert.ErrorContains(t, err, "has logged nothing for 10m0s")
+}
+
+func TestReadRejectsRunID(t *testing.T) {
+	for _, id := range []string{"", "../secrets", "a/b", `a\b`, ".."} {
+		err := Read(t.TempDir(), id, false, func([]byte, restic.Envelope) error { return nil })
+		assert.EqualError(t, err, fmt.Sprintf("invalid run id %q", id))
+	}
+}
@@ -0,0 +1,133 @@
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minor-industries/backup/restic"
+	"github.com/pkg/errors"
+)
+
+const (
+	pollInterval = 500 * time.Millisecond
+
+	// idleTimeout is how long a followed run may log nothing before it is
+	// taken to have ended without a RunDone message, e.g. by crashing
+	idleTimeout = 10 * time.Minute
+)
+
+// Read calls fn with every line of the log of runID and the envelope decoded
+// from it. With follow, Read keeps polling for new lines until the run's
+// RunDone message has been read, or the log hasn't been written to for
+// idleTimeout.
+func Read(
+	dir string,
+	runID string,
+	follow bool,
+	fn func(line []byte, env restic.Envelope) error,
+) error {
+	if runID == "" || strings.ContainsAny(runID, `/\`) || strings.Contains(runID, "..") {
+		return fmt.Errorf("invalid run id %q", runID)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, partName(runID, 0))); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("run %s not found", runID)
+		}
+		return errors.Wrap(err, "stat log file")
+	}
+
+	part := 0
+	var offset int64
+	for {
+		path := filepath.Join(dir, partName(runID, part))
+		done, n, err := readPart(path, offset, fn)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		offset += n
+
+		if _, err := os.Stat(filepath.Join(dir, partName(runID, part+1))); err == nil {
+			// the writer is done with this part, but may have appended to
+			// it since it was read
+			done, _, err := readPart(path, offset, fn)
+			if err != nil {
+				return err
+			}
+			if done {
+				return nil
+			}
+			part++
+			offset = 0
+			continue
+		}
+
+		if !follow {
+			return nil
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return errors.Wrap(err, "stat log file")
+		}
+		if time.Since(info.ModTime()) > idleTimeout {
+			return fmt.Errorf("run %s has logged nothing for %s, it may have ended without finishing", runID, idleTimeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// readPart reads complete lines of path starting at offset. It reports
+// whether a RunDone message was read and how many bytes were consumed.
+func readPart(
+	path string,
+	offset int64,
+	fn func(line []byte, env restic.Envelope) error,
+) (bool, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, 0, errors.Wrap(err, "open log file")
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return false, 0, errors.Wrap(err, "seek")
+	}
+
+	var consumed int64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a partial line is read again once it has been completed
+			return false, consumed, nil
+		}
+		if err != nil {
+			return false, consumed, errors.Wrap(err, "read log file")
+		}
+		consumed += int64(len(line))
+
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		env, err := restic.DecodeEnvelope(line)
+		if err != nil {
+			return false, consumed, errors.Wrap(err, "decode log entry")
+		}
+
+		if err := fn(line, env); err != nil {
+			return false, consumed, err
+		}
+
+		if _, ok := env.Message.(restic.RunDone); ok {
+			return true, consumed, nil
+		}
+	}
+}
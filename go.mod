@@ -3,12 +3,15 @@ module github.com/minor-industries/backup
 go 1.21.1
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/jessevdk/go-flags v1.6.1
 	github.com/keybase/go-keychain v0.0.0-20231219164618-57a3676c3af6
 	github.com/peterh/liner v1.2.2
 	github.com/pkg/errors v0.9.1
 	github.com/samber/lo v1.47.0
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/crypto v0.24.0
+	golang.org/x/term v0.21.0
 )
 
 require (
@@ -8,11 +8,15 @@ import (
 
 var errNotImplemented = errors.New("keychain only available on MacOS")
 
-func NewProfile(profileName string, profile *Profile) error {
+func addProfile(profileName string, data []byte) error {
 	return errNotImplemented
 }
 
-func LoadProfile(profileName string) (*Profile, error) {
+func replaceProfile(profileName string, data []byte) error {
+	return errNotImplemented
+}
+
+func loadProfileData(profileName string) ([]byte, error) {
 	return nil, errNotImplemented
 }
 
@@ -1,7 +1,6 @@
 package keychain
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/keybase/go-keychain"
 	"github.com/pkg/errors"
@@ -12,22 +11,33 @@ const (
 	KeychainServiceName = "restic-backup-profile"
 )
 
-func NewProfile(profileName string, profile *Profile) error {
-	out, err := json.Marshal(profile)
-	if err != nil {
-		return errors.Wrap(err, "marshal")
-	}
-
+func addProfile(profileName string, data []byte) error {
 	item := keychain.NewItem()
 	item.SetSecClass(keychain.SecClassGenericPassword)
 	item.SetService(KeychainServiceName)
 	item.SetAccount(profileName)
-	item.SetData(out)
-	err = keychain.AddItem(item)
+	item.SetData(data)
+	err := keychain.AddItem(item)
 	return errors.Wrap(err, "add item")
 }
 
-func LoadProfile(profileName string) (*Profile, error) {
+// replaceProfile replaces the data of an existing profile in a single
+// keychain operation, so a failure leaves the old profile intact.
+func replaceProfile(profileName string, data []byte) error {
+	query := keychain.NewItem()
+	query.SetSecClass(keychain.SecClassGenericPassword)
+	query.SetService(KeychainServiceName)
+	query.SetAccount(profileName)
+	query.SetMatchLimit(keychain.MatchLimitOne)
+
+	update := keychain.NewItem()
+	update.SetData(data)
+
+	err := keychain.UpdateItem(query, update)
+	return errors.Wrap(err, "update item")
+}
+
+func loadProfileData(profileName string) ([]byte, error) {
 	item, err := keychain.GetGenericPassword(KeychainServiceName, profileName, "", "")
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get profile from keychain")
@@ -36,12 +46,7 @@ func LoadProfile(profileName string) (*Profile, error) {
 		return nil, fmt.Errorf("profile %s not found in keychain", profileName)
 	}
 
-	var result Profile
-	if err := json.Unmarshal(item, &result); err != nil {
-		return nil, errors.Wrap(err, "failed to unmarshal profile data")
-	}
-
-	return &result, nil
+	return item, nil
 }
 
 func DeleteProfile(profileName string) error {
@@ -0,0 +1,164 @@
+package keychain
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// CurrentVersion is the version of the stored profile format written by
+// this package.
+//
+//   - 1: a flat object of environment variables, optionally with "meta";
+//     blobs without a "version" key are version 1
+//   - 2: {"version": 2, "env": {...}, "meta": {...}}
+const CurrentVersion = 2
+
+// migration upgrades the fields of a stored profile by one version and
+// describes what it changed.
+type migration func(fields map[string]json.RawMessage) ([]string, error)
+
+// migrations[i] upgrades version i+1 to version i+2.
+var migrations = []migration{
+	migrateFlatEnv,
+}
+
+// migrateFlatEnv moves the top-level environment variables of version 1 into
+// "env".
+func migrateFlatEnv(fields map[string]json.RawMessage) ([]string, error) {
+	env := map[string]json.RawMessage{}
+	for name, raw := range fields {
+		if name == metaKey {
+			continue
+		}
+		env[name] = raw
+		delete(fields, name)
+	}
+
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	fields[envKey] = raw
+
+	return []string{fmt.Sprintf("moved %d variables into env", len(env))}, nil
+}
+
+// migrate upgrades stored profile data to CurrentVersion. It returns the
+// upgraded fields, the version the data was stored in and the changes made.
+func migrate(data []byte) (map[string]json.RawMessage, int, []string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, 0, nil, err
+	}
+
+	version := 1
+	if raw, ok := fields[versionKey]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, 0, nil, errors.Wrap(err, "version")
+		}
+		delete(fields, versionKey)
+	}
+
+	if version < 1 || version > CurrentVersion {
+		return nil, 0, nil, fmt.Errorf("unsupported profile version %d", version)
+	}
+
+	var changes []string
+	for v := version; v < CurrentVersion; v++ {
+		changed, err := migrations[v-1](fields)
+		if err != nil {
+			return nil, 0, nil, errors.Wrapf(err, "migrate version %d", v)
+		}
+		for _, change := range changed {
+			changes = append(changes, fmt.Sprintf("v%d->v%d: %s", v, v+1, change))
+		}
+	}
+
+	return fields, version, changes, nil
+}
+
+// MigrationResult reports what MigrateProfile did to a profile.
+type MigrationResult struct {
+	From    int
+	To      int
+	Changes []string
+}
+
+// MigrateProfile upgrades a stored profile to the current format. With
+// dryRun the changes are only reported.
+func MigrateProfile(profileName string, dryRun bool) (*MigrationResult, error) {
+	data, err := loadProfileData(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	_, from, changes, err := migrate(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "migrate")
+	}
+
+	result := &MigrationResult{From: from, To: CurrentVersion, Changes: changes}
+	if from == CurrentVersion || dryRun {
+		return result, nil
+	}
+
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal profile data")
+	}
+
+	out, err := encodeProfile(&profile, CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+	return result, errors.Wrap(replaceProfile(profileName, out), "write migrated profile")
+}
+
+// LoadProfile loads a profile stored in any supported version. Profiles are
+// only upgraded to the current version by MigrateProfile.
+func LoadProfile(profileName string) (*Profile, error) {
+	profile, _, err := loadProfile(profileName)
+	return profile, err
+}
+
+// loadProfile loads a profile and the version it is stored in.
+func loadProfile(profileName string) (*Profile, int, error) {
+	data, err := loadProfileData(profileName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var result Profile
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to unmarshal profile data")
+	}
+
+	_, version, _, err := migrate(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &result, version, nil
+}
+
+// encodeProfile returns the stored form of profile in the given version, so
+// that writing a profile doesn't upgrade it behind the back of older
+// binaries still reading it.
+func encodeProfile(profile *Profile, version int) ([]byte, error) {
+	if version != 1 {
+		out, err := json.Marshal(profile)
+		return out, errors.Wrap(err, "marshal")
+	}
+
+	flat := map[string]any{}
+	for name, value := range profile.Vars() {
+		flat[name] = value
+	}
+	if !profile.Meta.isZero() {
+		flat[metaKey] = profile.Meta
+	}
+	out, err := json.Marshal(flat)
+	return out, errors.Wrap(err, "marshal")
+}
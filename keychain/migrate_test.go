@@ -0,0 +1,73 @@
+package keychain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	v1 := []byte(`{
+		"RESTIC_REPOSITORY": "/srv/restic",
+		"RESTIC_PASSWORD": "s3cret",
+		"meta": {"description": "nas"}
+	}`)
+
+	fields, version, changes, err := migrate(v1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, []string{"v1->v2: moved 2 variables into env"}, changes)
+	assert.JSONEq(t, `{"RESTIC_REPOSITORY": "/srv/restic", "RESTIC_PASSWORD": "s3cret"}`, string(fields[envKey]))
+	assert.JSONEq(t, `{"description": "nas"}`, string(fields[metaKey]))
+
+	var p Profile
+	require.NoError(t, json.Unmarshal(v1, &p))
+	v2, err := json.Marshal(p)
+	require.NoError(t, err)
+
+	_, version, changes, err = migrate(v2)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentVersion, version)
+	assert.Empty(t, changes)
+
+	var migrated Profile
+	require.NoError(t, json.Unmarshal(v2, &migrated))
+	assert.Equal(t, p, migrated)
+
+	_, _, _, err = migrate([]byte(`{"version": 99}`))
+	assert.EqualError(t, err, "unsupported profile version 99")
+}
+
+func TestEncodeProfileKeepsVersion(t *testing.T) {
+	v1 := []byte(`{"RESTIC_REPOSITORY": "/srv/restic", "RESTIC_PASSWORD": "s3cret"}`)
+
+	var p Profile
+	require.NoError(t, json.Unmarshal(v1, &p))
+	p.Meta.Description = "nas"
+
+	// writing a version 1 profile, e.g. to record a backup, keeps it
+	// readable by binaries that only know version 1
+	data, err := encodeProfile(&p, 1)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"RESTIC_REPOSITORY": "/srv/restic",
+		"RESTIC_PASSWORD": "s3cret",
+		"meta": {"description": "nas"}
+	}`, string(data))
+
+	_, version, _, err := migrate(data)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	var decoded Profile
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, p, decoded)
+
+	data, err = encodeProfile(&p, CurrentVersion)
+	require.NoError(t, err)
+	_, version, _, err = migrate(data)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentVersion, version)
+}
@@ -0,0 +1,72 @@
+package keychain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseProfile reads a profile from a flat JSON object or a dotenv file of
+// NAME=value lines.
+func ParseProfile(data []byte) (*Profile, error) {
+	var p Profile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &p); err != nil {
+			return nil, errors.Wrap(err, "parse json")
+		}
+		return &p, nil
+	}
+
+	vars, err := parseDotenv(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse dotenv")
+	}
+	for _, kv := range vars {
+		p.Set(kv[0], kv[1])
+	}
+	return &p, nil
+}
+
+// parseDotenv parses NAME=value lines, optionally prefixed with "export".
+// Blank lines and lines starting with # are skipped. Double-quoted values
+// use Go escapes, single-quoted values are taken literally.
+func parseDotenv(data []byte) ([][2]string, error) {
+	var result [][2]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("line %d: expected NAME=value", lineNo)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				// don't echo the value, it is likely a secret
+				return nil, fmt.Errorf("line %d: invalid quoted value for %s", lineNo, name)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+
+		result = append(result, [2]string{name, value})
+	}
+
+	return result, scanner.Err()
+}
@@ -0,0 +1,120 @@
+package keychain
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@+-]{0,63}$`)
+
+// ValidateProfileName checks that name is usable as a profile name. Names end
+// up in keychain items, file names and shell prompts, so they are limited to
+// letters, digits and a few punctuation characters.
+func ValidateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	return nil
+}
+
+// NewProfile stores a new profile, recording its creation time.
+func NewProfile(profileName string, profile *Profile) error {
+	profile.touch(time.Now())
+	data, err := encodeProfile(profile, CurrentVersion)
+	if err != nil {
+		return err
+	}
+	return addProfile(profileName, data)
+}
+
+// UpdateProfile atomically replaces an existing profile, recording the time
+// of the change. The profile keeps the version it is stored in.
+func UpdateProfile(profileName string, profile *Profile) error {
+	_, version, err := loadProfile(profileName)
+	if err != nil {
+		return err
+	}
+
+	profile.touch(time.Now())
+	return writeProfile(profileName, profile, version)
+}
+
+// RecordSuccess stores t as the time of the profile's last successful
+// backup. It doesn't count as a change to the profile.
+func RecordSuccess(profileName string, t time.Time) error {
+	profile, version, err := loadProfile(profileName)
+	if err != nil {
+		return err
+	}
+
+	t = t.UTC().Truncate(time.Second)
+	profile.Meta.LastSuccess = &t
+	return writeProfile(profileName, profile, version)
+}
+
+// writeProfile replaces an existing profile, storing it in the given version.
+func writeProfile(profileName string, profile *Profile, version int) error {
+	data, err := encodeProfile(profile, version)
+	if err != nil {
+		return err
+	}
+	return replaceProfile(profileName, data)
+}
+
+// RenameProfile stores a profile under a new name, keeping its metadata.
+func RenameProfile(oldName string, newName string) error {
+	profile, version, err := loadForCopy(oldName, newName)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeProfile(profile, version)
+	if err != nil {
+		return err
+	}
+	if err := addProfile(newName, data); err != nil {
+		return errors.Wrap(err, "add renamed profile")
+	}
+
+	if err := DeleteProfile(oldName); err != nil {
+		return errors.Wrapf(err, "profile copied to %s but not removed", newName)
+	}
+	return nil
+}
+
+// CopyProfile stores a copy of a profile under a new name, in the version
+// the original is stored in. The copy starts out with fresh timestamps.
+func CopyProfile(srcName string, dstName string) error {
+	profile, version, err := loadForCopy(srcName, dstName)
+	if err != nil {
+		return err
+	}
+
+	profile.Meta.Created = nil
+	profile.Meta.Updated = nil
+	profile.Meta.LastSuccess = nil
+	profile.touch(time.Now())
+
+	data, err := encodeProfile(profile, version)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(addProfile(dstName, data), "add copied profile")
+}
+
+func loadForCopy(srcName string, dstName string) (*Profile, int, error) {
+	names, err := ListProfiles()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "list profiles")
+	}
+	if lo.Contains(names, dstName) {
+		return nil, 0, fmt.Errorf("profile %s already exists", dstName)
+	}
+
+	profile, version, err := loadProfile(srcName)
+	return profile, version, errors.Wrap(err, "load profile")
+}
@@ -1,8 +1,168 @@
 package keychain
 
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// keys of the stored JSON object, see CurrentVersion
+const (
+	versionKey = "version"
+	envKey     = "env"
+	metaKey    = "meta"
+)
+
+// Profile is stored in the keychain as a versioned JSON object of
+// environment variables and metadata. The restic and AWS variables have
+// their own fields, all other variables, e.g. B2_ACCOUNT_KEY, are kept in Env.
 type Profile struct {
-	AwsAccessKeyID     string `json:"AWS_ACCESS_KEY_ID,omitempty"`
-	AwsSecretAccessKey string `json:"AWS_SECRET_ACCESS_KEY,omitempty"`
-	ResticRepository   string `json:"RESTIC_REPOSITORY,omitempty"`
-	ResticPassword     string `json:"RESTIC_PASSWORD,omitempty"`
+	AwsAccessKeyID     string            `json:"AWS_ACCESS_KEY_ID,omitempty"`
+	AwsSecretAccessKey string            `json:"AWS_SECRET_ACCESS_KEY,omitempty"`
+	ResticRepository   string            `json:"RESTIC_REPOSITORY,omitempty"`
+	ResticPassword     string            `json:"RESTIC_PASSWORD,omitempty"`
+	Env                map[string]string `json:"-"`
+	Meta               Meta              `json:"-"`
+}
+
+type Meta struct {
+	Description string     `json:"description,omitempty"`
+	Labels      []string   `json:"labels,omitempty"`
+	Created     *time.Time `json:"created,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	// LastSuccess is written by the backup runner after a successful backup
+	// to the profile's repository.
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// Get returns the value of the field with the given environment variable name.
+func (p *Profile) Get(name string) string {
+	switch name {
+	case "AWS_ACCESS_KEY_ID":
+		return p.AwsAccessKeyID
+	case "AWS_SECRET_ACCESS_KEY":
+		return p.AwsSecretAccessKey
+	case "RESTIC_REPOSITORY":
+		return p.ResticRepository
+	case "RESTIC_PASSWORD":
+		return p.ResticPassword
+	default:
+		return p.Env[name]
+	}
+}
+
+// Set sets the named variable. An empty value removes it.
+func (p *Profile) Set(name string, value string) {
+	switch name {
+	case "AWS_ACCESS_KEY_ID":
+		p.AwsAccessKeyID = value
+	case "AWS_SECRET_ACCESS_KEY":
+		p.AwsSecretAccessKey = value
+	case "RESTIC_REPOSITORY":
+		p.ResticRepository = value
+	case "RESTIC_PASSWORD":
+		p.ResticPassword = value
+	default:
+		if value == "" {
+			delete(p.Env, name)
+			return
+		}
+		if p.Env == nil {
+			p.Env = map[string]string{}
+		}
+		p.Env[name] = value
+	}
+}
+
+// Vars returns all variables of the profile.
+func (p *Profile) Vars() map[string]string {
+	result := make(map[string]string, len(p.Env)+4)
+	for name, value := range p.Env {
+		result[name] = value
+	}
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID",
+		"AWS_SECRET_ACCESS_KEY",
+		"RESTIC_REPOSITORY",
+		"RESTIC_PASSWORD",
+	} {
+		if value := p.Get(name); value != "" {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+// Names returns the names of all variables of the profile in sorted order.
+func (p *Profile) Names() []string {
+	vars := p.Vars()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// storedProfile is the current stored format.
+type storedProfile struct {
+	Version int               `json:"version"`
+	Env     map[string]string `json:"env"`
+	Meta    *Meta             `json:"meta,omitempty"`
+}
+
+func (p Profile) MarshalJSON() ([]byte, error) {
+	stored := storedProfile{Version: CurrentVersion, Env: p.Vars()}
+	if !p.Meta.isZero() {
+		stored.Meta = &p.Meta
+	}
+	return json.Marshal(stored)
+}
+
+// UnmarshalJSON decodes a profile stored in any supported version.
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	fields, _, _, err := migrate(data)
+	if err != nil {
+		return err
+	}
+
+	*p = Profile{}
+
+	if raw, ok := fields[envKey]; ok {
+		var env map[string]string
+		if err := json.Unmarshal(raw, &env); err != nil {
+			return errors.Wrap(err, envKey)
+		}
+		for name, value := range env {
+			p.Set(name, value)
+		}
+	}
+
+	if raw, ok := fields[metaKey]; ok {
+		if err := json.Unmarshal(raw, &p.Meta); err != nil {
+			return errors.Wrap(err, metaKey)
+		}
+	}
+
+	return nil
+}
+
+func (m *Meta) isZero() bool {
+	return m.Description == "" &&
+		len(m.Labels) == 0 &&
+		m.Created == nil &&
+		m.Updated == nil &&
+		m.LastSuccess == nil
+}
+
+// touch records now as the time the profile was changed, and as the time it
+// was created if that isn't known yet.
+func (p *Profile) touch(now time.Time) {
+	now = now.UTC().Truncate(time.Second)
+	if p.Meta.Created == nil {
+		p.Meta.Created = &now
+	}
+	p.Meta.Updated = &now
 }
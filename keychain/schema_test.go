@@ -0,0 +1,113 @@
+package keychain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileJSON(t *testing.T) {
+	var p Profile
+	err := json.Unmarshal([]byte(`{
+		"RESTIC_REPOSITORY": "b2:bucket:path",
+		"RESTIC_PASSWORD": "s3cret",
+		"B2_ACCOUNT_ID": "id",
+		"B2_ACCOUNT_KEY": "key"
+	}`), &p)
+	require.NoError(t, err)
+
+	assert.Equal(t, Profile{
+		ResticRepository: "b2:bucket:path",
+		ResticPassword:   "s3cret",
+		Env:              map[string]string{"B2_ACCOUNT_ID": "id", "B2_ACCOUNT_KEY": "key"},
+	}, p)
+	assert.Equal(t, "key", p.Get("B2_ACCOUNT_KEY"))
+	assert.Equal(t, []string{"B2_ACCOUNT_ID", "B2_ACCOUNT_KEY", "RESTIC_PASSWORD", "RESTIC_REPOSITORY"}, p.Names())
+
+	p.Set("B2_ACCOUNT_ID", "")
+	p.Set("AWS_ACCESS_KEY_ID", "akid")
+
+	out, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"version": 2,
+		"env": {
+			"AWS_ACCESS_KEY_ID": "akid",
+			"RESTIC_REPOSITORY": "b2:bucket:path",
+			"RESTIC_PASSWORD": "s3cret",
+			"B2_ACCOUNT_KEY": "key"
+		}
+	}`, string(out))
+}
+
+func TestParseProfile(t *testing.T) {
+	expected := &Profile{
+		ResticRepository: "rest:https://host:8000/repo",
+		ResticPassword:   `pa"ss word`,
+		Env: map[string]string{
+			"RESTIC_REST_USERNAME": "backup",
+			"RESTIC_REST_PASSWORD": "it's $ecret",
+		},
+	}
+
+	p, err := ParseProfile([]byte(`
+# rest server
+export RESTIC_REPOSITORY=rest:https://host:8000/repo
+RESTIC_PASSWORD="pa\"ss word"
+RESTIC_REST_USERNAME = backup
+RESTIC_REST_PASSWORD='it's $ecret'
+`))
+	require.NoError(t, err)
+	assert.Equal(t, expected, p)
+
+	p, err = ParseProfile([]byte(`  {
+		"RESTIC_REPOSITORY": "rest:https://host:8000/repo",
+		"RESTIC_PASSWORD": "pa\"ss word",
+		"RESTIC_REST_USERNAME": "backup",
+		"RESTIC_REST_PASSWORD": "it's $ecret"
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, expected, p)
+
+	_, err = ParseProfile([]byte("RESTIC_PASSWORD\n"))
+	assert.EqualError(t, err, "parse dotenv: line 1: expected NAME=value")
+}
+
+func TestProfileMetaJSON(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	p := Profile{
+		ResticRepository: "/srv/restic",
+		ResticPassword:   "s3cret",
+		Meta: Meta{
+			Description: "laptop to nas",
+			Labels:      []string{"home"},
+			Created:     &created,
+		},
+	}
+
+	out, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"version": 2,
+		"env": {
+			"RESTIC_REPOSITORY": "/srv/restic",
+			"RESTIC_PASSWORD": "s3cret"
+		},
+		"meta": {
+			"description": "laptop to nas",
+			"labels": ["home"],
+			"created": "2024-05-01T12:00:00Z"
+		}
+	}`, string(out))
+
+	var loaded Profile
+	require.NoError(t, json.Unmarshal(out, &loaded))
+	assert.Equal(t, p, loaded)
+
+	loaded.touch(created.Add(time.Hour))
+	assert.Equal(t, created, *loaded.Meta.Created)
+	assert.Equal(t, created.Add(time.Hour), *loaded.Meta.Updated)
+}
@@ -0,0 +1,221 @@
+package restic
+
+import (
+	"os/exec"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+)
+
+// DefaultCompareTolerance is how far apart in time two snapshots with
+// different trees may be and still count as the same backup, e.g. when one
+// run backs up to several targets one after the other.
+const DefaultCompareTolerance = time.Hour
+
+// CompareOptions selects the snapshots to compare. An empty Host compares
+// the snapshots of all hosts.
+type CompareOptions struct {
+	Host      string
+	Paths     []string
+	Tags      []string
+	Tolerance time.Duration
+}
+
+// TargetSnapshots holds the snapshots of one target, or the error listing
+// them.
+type TargetSnapshots struct {
+	Target          string           `json:"target"`
+	Repository      string           `json:"repository,omitempty"`
+	KeychainProfile string           `json:"keychain_profile,omitempty"`
+	Snapshots       []ResticSnapshot `json:"snapshots"`
+	Error           string           `json:"error,omitempty"`
+}
+
+// SnapshotMatch is one backup as found on the compared targets. Snapshots
+// maps the name of every target holding the backup to its snapshot id there.
+type SnapshotMatch struct {
+	Time      time.Time         `json:"time"`
+	Hostname  string            `json:"hostname"`
+	Paths     []string          `json:"paths"`
+	Tags      []string          `json:"tags,omitempty"`
+	Snapshots map[string]string `json:"snapshots"`
+}
+
+// TargetLag describes a target missing backups newer than its latest one.
+// Latest is zero when the target holds none of the matched backups.
+type TargetLag struct {
+	Target  string    `json:"target"`
+	Latest  time.Time `json:"latest"`
+	Missing int       `json:"missing"`
+}
+
+// Comparison is the result of Compare. Matches are sorted by time; Gaps are
+// the matches missing from at least one target that could be listed.
+type Comparison struct {
+	Targets []TargetSnapshots `json:"targets"`
+	Matches []SnapshotMatch   `json:"matches"`
+	Gaps    []SnapshotMatch   `json:"gaps"`
+	Behind  []TargetLag       `json:"behind"`
+}
+
+// Compare lists the snapshots of every configured target and keychain
+// profile and matches them up. Errors are recorded per target so one
+// unreachable repository doesn't hide the others.
+func Compare(opts *cfg.BackupConfig, options CompareOptions) *Comparison {
+	var targets []TargetSnapshots
+
+	for _, target := range opts.Targets {
+		masked, _ := MaskRepository(target.ResticRepository)
+		name := target.Name
+		if name == "" {
+			name = masked
+		}
+		result := TargetSnapshots{Target: name, Repository: masked}
+
+		resolved, err := resolveTarget(&target)
+		if err == nil {
+			result.Snapshots, err = filteredSnapshots(opts, resolved, options)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		targets = append(targets, result)
+	}
+
+	for _, p := range opts.KeychainProfiles {
+		result := TargetSnapshots{Target: p.Profile, KeychainProfile: p.Profile}
+
+		target, err := loadProfileTarget(p.Profile)
+		if err == nil {
+			result.Repository, _ = MaskRepository(target.ResticRepository)
+			result.Snapshots, err = filteredSnapshots(opts, target, options)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		targets = append(targets, result)
+	}
+
+	tolerance := options.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultCompareTolerance
+	}
+	return compareSnapshots(targets, tolerance)
+}
+
+func filteredSnapshots(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	options CompareOptions,
+) ([]ResticSnapshot, error) {
+	var hosts []string
+	if options.Host != "" {
+		hosts = []string{options.Host}
+	}
+
+	args := []string{"snapshots", "--json"}
+	args = append(args, filterArgs(hosts, options.Paths, options.Tags)...)
+	cmd := exec.Command(opts.ResticPath, args...)
+
+	var snapshots []ResticSnapshot
+	if err := jsonResticCommand(target, cmd, &snapshots); err != nil {
+		return nil, errors.Wrap(err, "snapshots")
+	}
+
+	return snapshots, nil
+}
+
+// compareSnapshots groups the snapshots of targets into matches. Two
+// snapshots match when they have the same host, paths and tags, and either
+// the same tree or times at most tolerance apart. Each snapshot joins the
+// closest earlier match that lacks its target.
+func compareSnapshots(targets []TargetSnapshots, tolerance time.Duration) *Comparison {
+	type entry struct {
+		target   string
+		snapshot ResticSnapshot
+	}
+
+	var entries []entry
+	var listed []string
+	for _, t := range targets {
+		if t.Error != "" {
+			continue
+		}
+		listed = append(listed, t.Target)
+		for _, s := range t.Snapshots {
+			entries = append(entries, entry{target: t.Target, snapshot: s})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].snapshot.Time.Before(entries[j].snapshot.Time)
+	})
+
+	var matches []SnapshotMatch
+	var trees []map[string]bool
+	for _, e := range entries {
+		s := e.snapshot
+		best := -1
+		for i := len(matches) - 1; i >= 0; i-- {
+			m := matches[i]
+			if _, ok := m.Snapshots[e.target]; ok {
+				continue
+			}
+			if m.Hostname != s.Hostname || !sameSet(m.Paths, s.Paths) || !sameSet(m.Tags, s.Tags) {
+				continue
+			}
+			if trees[i][s.Tree] || s.Time.Sub(m.Time) <= tolerance {
+				best = i
+				break
+			}
+		}
+
+		if best < 0 {
+			matches = append(matches, SnapshotMatch{
+				Time:      s.Time,
+				Hostname:  s.Hostname,
+				Paths:     s.Paths,
+				Tags:      s.Tags,
+				Snapshots: map[string]string{},
+			})
+			trees = append(trees, map[string]bool{})
+			best = len(matches) - 1
+		}
+		matches[best].Snapshots[e.target] = s.ID
+		trees[best][s.Tree] = true
+	}
+
+	result := &Comparison{Targets: targets, Matches: matches}
+
+	for _, m := range matches {
+		if len(m.Snapshots) < len(listed) {
+			result.Gaps = append(result.Gaps, m)
+		}
+	}
+
+	for _, name := range listed {
+		lag := TargetLag{Target: name}
+		for _, m := range matches {
+			if _, ok := m.Snapshots[name]; ok {
+				lag = TargetLag{Target: name, Latest: m.Time}
+			} else {
+				lag.Missing++
+			}
+		}
+		if lag.Missing > 0 {
+			result.Behind = append(result.Behind, lag)
+		}
+	}
+
+	return result
+}
+
+func sameSet(a, b []string) bool {
+	a = slices.Clone(a)
+	b = slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,71 @@
+package restic
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareSnapshots(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := func(id string, hours int, tree string) ResticSnapshot {
+		return ResticSnapshot{
+			ID:       id,
+			Time:     base.Add(time.Duration(hours) * time.Hour),
+			Tree:     tree,
+			Hostname: "laptop",
+			Paths:    []string{"/home"},
+		}
+	}
+
+	// the nas and the offsite copy of it agree, s3 was backed up to a few
+	// minutes later with a different chunker, missed a day and stopped
+	s3First := snapshot("s1", 0, "x1")
+	s3First.Time = s3First.Time.Add(5 * time.Minute)
+	tagged := snapshot("n4", 72, "t4")
+	tagged.Tags = []string{"manual"}
+
+	result := compareSnapshots([]TargetSnapshots{
+		{Target: "nas", Snapshots: []ResticSnapshot{
+			snapshot("n1", 0, "t1"), snapshot("n2", 24, "t2"), snapshot("n3", 48, "t3"), tagged,
+		}},
+		{Target: "offsite", Snapshots: []ResticSnapshot{
+			// copies keep the time, the later one was copied days after
+			snapshot("o1", 0, "t1"), snapshot("o2", 24, "t2"), snapshot("o3", 48, "t3"), tagged,
+		}},
+		{Target: "s3", Snapshots: []ResticSnapshot{s3First, snapshot("s3", 48, "x3")}},
+		{Target: "broken", Error: "unreachable"},
+	}, time.Hour)
+
+	ids := func(matches []SnapshotMatch) []map[string]string {
+		var result []map[string]string
+		for _, m := range matches {
+			result = append(result, m.Snapshots)
+		}
+		return result
+	}
+
+	assert.Equal(t, []map[string]string{
+		{"nas": "n1", "offsite": "o1", "s3": "s1"},
+		{"nas": "n2", "offsite": "o2"},
+		{"nas": "n3", "offsite": "o3", "s3": "s3"},
+		{"nas": "n4", "offsite": "n4"},
+	}, ids(result.Matches))
+
+	assert.Equal(t, []map[string]string{
+		{"nas": "n2", "offsite": "o2"},
+		{"nas": "n4", "offsite": "n4"},
+	}, ids(result.Gaps))
+
+	assert.Equal(t, []TargetLag{
+		{Target: "s3", Latest: base.Add(48 * time.Hour), Missing: 1},
+	}, result.Behind)
+
+	// an unreachable target doesn't look like one without snapshots
+	data, err := json.Marshal(result.Targets[3])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"target":"broken","snapshots":null,"error":"unreachable"}`, string(data))
+}
@@ -0,0 +1,259 @@
+package restic
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// CopyFilter selects the snapshots to copy. Empty fields select everything;
+// a snapshot is copied when it matches every field that is set.
+type CopyFilter struct {
+	Hosts []string
+	Paths []string
+	// Tags are tag lists as taken by restic's --tag, e.g. "a,b" selects
+	// snapshots with both tags.
+	Tags        []string
+	SnapshotIDs []string
+}
+
+// CopyResult lists the snapshots that a copy added to the destination.
+type CopyResult struct {
+	Copied []ResticSnapshot
+}
+
+// Copy copies the snapshots of from selected by filter into the repository
+// of to. Snapshots already copied earlier are skipped by restic. Both
+// repositories are opened by a single restic process, so a variable such as
+// AWS_ACCESS_KEY_ID that both need must have the same value for both.
+func Copy(
+	opts *cfg.BackupConfig,
+	from *cfg.BackupTarget,
+	to *cfg.BackupTarget,
+	filter CopyFilter,
+) (*CopyResult, error) {
+	from, err := resolveTarget(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "source")
+	}
+	to, err = resolveTarget(to)
+	if err != nil {
+		return nil, errors.Wrap(err, "destination")
+	}
+	return copySnapshots(opts, from, to, filter)
+}
+
+// copySnapshots is Copy for targets whose secrets are already resolved.
+func copySnapshots(
+	opts *cfg.BackupConfig,
+	from *cfg.BackupTarget,
+	to *cfg.BackupTarget,
+	filter CopyFilter,
+) (*CopyResult, error) {
+	redactor := NewRedactor(*from, *to)
+
+	// restic copy doesn't report what it copied, so compare the snapshots of
+	// the destination before and after
+	before, err := snapshots(opts, to, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "list destination snapshots")
+	}
+
+	err = runCopy(opts, from, to, filter, redactor)
+	if err != nil {
+		return nil, errors.Wrap(err, "copy")
+	}
+
+	after, err := snapshots(opts, to, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "list destination snapshots")
+	}
+
+	known := lo.SliceToMap(before, func(s ResticSnapshot) (string, bool) { return s.ID, true })
+	return &CopyResult{
+		Copied: lo.Filter(after, func(s ResticSnapshot, _ int) bool { return !known[s.ID] }),
+	}, nil
+}
+
+func runCopy(
+	opts *cfg.BackupConfig,
+	from *cfg.BackupTarget,
+	to *cfg.BackupTarget,
+	filter CopyFilter,
+	redactor *Redactor,
+) error {
+	if from.CACertPath != "" && from.CACertPath != to.CACertPath {
+		return errors.New("source and destination must use the same CA certificate")
+	}
+
+	args := []string{"copy"}
+	args = append(args, filterArgs(filter.Hosts, filter.Paths, filter.Tags)...)
+	args = append(args, filter.SnapshotIDs...)
+
+	cmd := exec.Command(opts.ResticPath, args...)
+
+	cleanup, err := addEnv(to, cmd)
+	if err != nil {
+		return errors.Wrap(err, "prepare restic command")
+	}
+	defer cleanup()
+
+	sourceVars, err := sourceEnv(from, to)
+	if err != nil {
+		return err
+	}
+	// like the destination, the source repository is kept off the command
+	// line, where its credentials would be visible to other users
+	cmd.Env = append(cmd.Env, "RESTIC_FROM_REPOSITORY="+from.ResticRepository)
+	cmd.Env = append(cmd.Env, sourceVars...)
+
+	if from.ResticPassword != "" {
+		cleanupFrom, err := passwordFile(cmd, "--from-password-file", from.ResticPassword)
+		if err != nil {
+			return err
+		}
+		defer cleanupFrom()
+	}
+
+	_, err = runPreparedCommand(cmd, redactor)
+	return err
+}
+
+// filterArgs returns the restic flags selecting snapshots by host, path and
+// tag list.
+func filterArgs(hosts, paths, tags []string) []string {
+	var args []string
+	for _, host := range hosts {
+		args = append(args, "--host", host)
+	}
+	for _, path := range paths {
+		args = append(args, "--path", path)
+	}
+	for _, tag := range tags {
+		args = append(args, "--tag", tag)
+	}
+	return args
+}
+
+// sourceEnv returns the backend variables of from that the environment of to
+// lacks. A variable that both set to different values can't be passed to
+// restic and is an error.
+func sourceEnv(from, to *cfg.BackupTarget) ([]string, error) {
+	fromVars, err := backendEnv(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "source")
+	}
+	toVars, err := backendEnv(to)
+	if err != nil {
+		return nil, errors.Wrap(err, "destination")
+	}
+
+	existing := map[string]string{}
+	for _, kv := range toVars {
+		name, value, _ := strings.Cut(kv, "=")
+		existing[name] = value
+	}
+
+	var result []string
+	for _, kv := range fromVars {
+		name, value, _ := strings.Cut(kv, "=")
+		if v, ok := existing[name]; ok {
+			if v != value {
+				return nil, fmt.Errorf("%s differs between source and destination", name)
+			}
+			continue
+		}
+		result = append(result, kv)
+	}
+	return result, nil
+}
+
+// replica pairs a replica target with the primary it is copied from.
+type replica struct {
+	from cfg.BackupTarget
+	to   cfg.BackupTarget
+}
+
+// splitReplicas separates the targets that are backed up to from the
+// replicas that are copied to from them.
+func splitReplicas(targets []cfg.BackupTarget) ([]cfg.BackupTarget, []replica, error) {
+	var primaries []cfg.BackupTarget
+	for _, target := range targets {
+		if target.ReplicaOf == "" {
+			primaries = append(primaries, target)
+		}
+	}
+
+	var replicas []replica
+	for _, target := range targets {
+		if target.ReplicaOf == "" {
+			continue
+		}
+		name := targetMeta(&target).Target
+		primary, ok := lo.Find(primaries, func(t cfg.BackupTarget) bool {
+			return targetMeta(&t).Target == target.ReplicaOf
+		})
+		if !ok {
+			if lo.ContainsBy(targets, func(t cfg.BackupTarget) bool {
+				return targetMeta(&t).Target == target.ReplicaOf
+			}) {
+				return nil, nil, fmt.Errorf("target %s is a replica of %s, which is itself a replica", name, target.ReplicaOf)
+			}
+			return nil, nil, fmt.Errorf("target %s is a replica of unknown target %s", name, target.ReplicaOf)
+		}
+		replicas = append(replicas, replica{from: primary, to: target})
+	}
+
+	return primaries, replicas, nil
+}
+
+// replicaFilter selects the snapshots of this host, which is what a job's
+// backups are recorded under.
+func replicaFilter(opts *cfg.BackupConfig) CopyFilter {
+	host := opts.SourceHost
+	if host == "" {
+		// restic records the hostname by default
+		host, _ = os.Hostname()
+	}
+	if host == "" {
+		return CopyFilter{}
+	}
+	return CopyFilter{Hosts: []string{host}}
+}
+
+// copyTarget copies new snapshots to a replica and reports the outcome with a
+// CopyDone message.
+func copyTarget(opts *cfg.BackupConfig, rep *replica, r *run) error {
+	emit := r.callbackFor(&rep.to)
+	started := r.now()
+
+	result, err := copySnapshots(opts, &rep.from, &rep.to, replicaFilter(opts))
+
+	done := CopyDone{
+		From:            targetMeta(&rep.from).Target,
+		Repository:      targetMeta(&rep.to).Repository,
+		KeychainProfile: rep.to.KeychainProfile,
+		Outcome:         OutcomeSuccess,
+		Duration:        r.now().Sub(started).Seconds(),
+	}
+	if err != nil {
+		done.Outcome = OutcomeFailure
+		done.Error = err.Error()
+	} else {
+		done.Snapshots = lo.Map(result.Copied, func(s ResticSnapshot, _ int) string { return s.ID })
+		if recordErr := recordSuccess(&rep.to, r.now()); recordErr != nil {
+			_ = emit(StderrLine{Line: recordErr.Error()})
+		}
+	}
+
+	if cbErr := emit(done); cbErr != nil && err == nil {
+		return errors.Wrap(cbErr, "callback")
+	}
+
+	return err
+}
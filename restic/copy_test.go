@@ -0,0 +1,87 @@
+package restic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopy(t *testing.T) {
+	// each repository is a directory holding one JSON snapshot per file; copy
+	// adds a snapshot to the destination and records the source settings
+	opts, dir := fakeRestic(t, `case "$*" in
+"snapshots --json"*)
+	sep="["
+	for f in "$RESTIC_REPOSITORY"/*; do
+		[ -e "$f" ] || continue
+		printf '%s%s' "$sep" "$(cat "$f")"
+		sep=","
+	done
+	[ "$sep" = "[" ] && printf '['
+	echo "]" ;;
+"copy "*)
+	echo "RESTIC_FROM_REPOSITORY=$RESTIC_FROM_REPOSITORY B2_ACCOUNT_ID=$B2_ACCOUNT_ID" >> "$dir/copy-env"
+	echo '{"id":"new","tree":"t2","paths":["/home"],"hostname":"laptop","original":"orig"}' > "$RESTIC_REPOSITORY/new" ;;
+esac
+`)
+
+	replicaDir := filepath.Join(dir, "replica")
+	require.NoError(t, os.Mkdir(replicaDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(replicaDir, "old"),
+		[]byte(`{"id":"old","tree":"t1","paths":["/home"],"hostname":"laptop"}`), 0o600))
+
+	from := &cfg.BackupTarget{
+		ResticRepository: "b2:bucket:restic",
+		ResticPassword:   "from-password",
+		Env:              map[string]string{"B2_ACCOUNT_ID": "account"},
+	}
+	to := &cfg.BackupTarget{ResticRepository: replicaDir, ResticPassword: "to-password"}
+
+	result, err := Copy(opts, from, to, CopyFilter{Hosts: []string{"laptop"}, Tags: []string{"a,b"}})
+	require.NoError(t, err)
+	require.Len(t, result.Copied, 1)
+	assert.Equal(t, "new", result.Copied[0].ID)
+	assert.Equal(t, "orig", result.Copied[0].Original)
+
+	assert.Equal(t, []string{
+		" --from-password-file=from-password --password-file=to-password copy --host laptop --tag a,b",
+	}, fakeResticLog(t, dir, " copy "))
+	env, err := os.ReadFile(filepath.Join(dir, "copy-env"))
+	require.NoError(t, err)
+	assert.Equal(t, "RESTIC_FROM_REPOSITORY=b2:bucket:restic B2_ACCOUNT_ID=account\n", string(env))
+
+	// a single restic process can't use two values for one variable
+	s3 := func(key string) *cfg.BackupTarget {
+		return &cfg.BackupTarget{ResticRepository: "s3:s3.amazonaws.com/bucket", AwsAccessKeyId: key}
+	}
+	_, err = Copy(opts, s3("a"), s3("b"), CopyFilter{})
+	assert.ErrorContains(t, err, "AWS_ACCESS_KEY_ID differs between source and destination")
+}
+
+func TestSplitReplicas(t *testing.T) {
+	primaries, replicas, err := splitReplicas([]cfg.BackupTarget{
+		{Name: "local"},
+		{Name: "offsite", ReplicaOf: "nas"},
+		{KeychainProfile: "nas"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []cfg.BackupTarget{{Name: "local"}, {KeychainProfile: "nas"}}, primaries)
+	assert.Equal(t, []replica{{
+		from: cfg.BackupTarget{KeychainProfile: "nas"},
+		to:   cfg.BackupTarget{Name: "offsite", ReplicaOf: "nas"},
+	}}, replicas)
+
+	_, _, err = splitReplicas([]cfg.BackupTarget{{Name: "a", ReplicaOf: "missing"}})
+	assert.EqualError(t, err, "target a is a replica of unknown target missing")
+
+	_, _, err = splitReplicas([]cfg.BackupTarget{
+		{Name: "a"},
+		{Name: "b", ReplicaOf: "a"},
+		{Name: "c", ReplicaOf: "b"},
+	})
+	assert.EqualError(t, err, "target c is a replica of b, which is itself a replica")
+}
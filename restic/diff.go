@@ -0,0 +1,106 @@
+package restic
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+)
+
+// Modifiers of a ResticDiffChange.
+const (
+	DiffAdded    = "+"
+	DiffRemoved  = "-"
+	DiffModified = "M"
+	DiffType     = "T" // the type changed, e.g. from file to symlink
+	DiffMetadata = "U" // only the metadata changed
+	DiffBug      = "?" // restic couldn't tell what changed
+)
+
+// ResticDiffChange is a "change" message of "restic diff --json".
+type ResticDiffChange struct {
+	MessageType string `json:"message_type"`
+	Path        string `json:"path"`
+	Modifier    string `json:"modifier"`
+}
+
+// ResticDiffStat counts what was added or removed between two snapshots.
+type ResticDiffStat struct {
+	Files     int   `json:"files"`
+	Dirs      int   `json:"dirs"`
+	Others    int   `json:"others"`
+	DataBlobs int   `json:"data_blobs"`
+	TreeBlobs int   `json:"tree_blobs"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// ResticDiffStatistics is the "statistics" message closing the output of
+// "restic diff --json".
+type ResticDiffStatistics struct {
+	MessageType    string         `json:"message_type"`
+	SourceSnapshot string         `json:"source_snapshot"`
+	TargetSnapshot string         `json:"target_snapshot"`
+	ChangedFiles   int            `json:"changed_files"`
+	Added          ResticDiffStat `json:"added"`
+	Removed        ResticDiffStat `json:"removed"`
+}
+
+// SnapshotDiff is the decoded output of "restic diff --json".
+type SnapshotDiff struct {
+	Changes    []ResticDiffChange   `json:"changes"`
+	Statistics ResticDiffStatistics `json:"statistics"`
+}
+
+// Diff lists the changes between snapshots a and b of target's repository.
+// The snapshots may be given in any form restic accepts, such as a short id
+// or "latest".
+func Diff(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	a string,
+	b string,
+) (*SnapshotDiff, error) {
+	target, err := resolveTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(opts.ResticPath, "diff", "--json", a, b)
+	stdout, err := runResticCommand(target, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var result SnapshotDiff
+	var gotStatistics bool
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	// paths may be longer than the default limit
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		msg, err := decodeResticMessage(scanner.Bytes())
+		if err != nil {
+			return nil, errors.Wrap(err, "decode restic message")
+		}
+
+		switch msg := msg.(type) {
+		case ResticDiffChange:
+			result.Changes = append(result.Changes, msg)
+		case ResticDiffStatistics:
+			result.Statistics = msg
+			gotStatistics = true
+		default:
+			return nil, fmt.Errorf("unexpected message type %T", msg)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read restic output")
+	}
+	if !gotStatistics {
+		return nil, errors.New("restic diff didn't report statistics")
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,40 @@
+package restic
+
+import (
+	"testing"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	opts, _ := fakeRestic(t, `[ "$*" = "diff --json 4a2b 9f1c" ] || { echo "Fatal: unexpected arguments $*" >&2; exit 1; }
+cat <<'END'
+{"message_type":"change","path":"/home/alice/big.iso","modifier":"+"}
+{"message_type":"change","path":"/home/alice/notes.txt","modifier":"M"}
+{"message_type":"statistics","source_snapshot":"4a2b","target_snapshot":"9f1c","changed_files":2,"added":{"files":2,"dirs":0,"others":0,"data_blobs":812,"tree_blobs":1,"bytes":4294967296},"removed":{"files":1,"dirs":0,"others":0,"data_blobs":1,"tree_blobs":1,"bytes":120}}
+END
+`)
+	target := &cfg.BackupTarget{ResticRepository: "/srv/restic", ResticPassword: "s3cret"}
+
+	diff, err := Diff(opts, target, "4a2b", "9f1c")
+	require.NoError(t, err)
+	assert.Equal(t, &SnapshotDiff{
+		Changes: []ResticDiffChange{
+			{MessageType: "change", Path: "/home/alice/big.iso", Modifier: DiffAdded},
+			{MessageType: "change", Path: "/home/alice/notes.txt", Modifier: DiffModified},
+		},
+		Statistics: ResticDiffStatistics{
+			MessageType:    "statistics",
+			SourceSnapshot: "4a2b",
+			TargetSnapshot: "9f1c",
+			ChangedFiles:   2,
+			Added:          ResticDiffStat{Files: 2, DataBlobs: 812, TreeBlobs: 1, Bytes: 4294967296},
+			Removed:        ResticDiffStat{Files: 1, DataBlobs: 1, TreeBlobs: 1, Bytes: 120},
+		},
+	}, diff)
+
+	_, err = Diff(opts, target, "4a2b", "missing")
+	assert.ErrorContains(t, err, "Fatal: unexpected arguments")
+}
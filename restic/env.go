@@ -0,0 +1,135 @@
+package restic
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// inheritedVars are removed from the environment passed to restic, along
+// with the secret variables in KnownEnvVars, so that credentials of the
+// calling process never leak into, or override, the target's own.
+// Non-secret settings such as AWS_PROFILE are kept unless the target sets
+// them.
+var inheritedVars = []string{
+	"RESTIC_REPOSITORY_FILE",
+	"RESTIC_PASSWORD_FILE",
+	"RESTIC_PASSWORD_COMMAND",
+	"RESTIC_CACERT",
+	"RESTIC_FROM_REPOSITORY",
+	"RESTIC_FROM_REPOSITORY_FILE",
+	"RESTIC_FROM_PASSWORD",
+	"RESTIC_FROM_PASSWORD_FILE",
+	"RESTIC_FROM_PASSWORD_COMMAND",
+}
+
+// addEnv prepares cmd to run against target. The repository password is
+// written to a pipe that restic reads through --password-file, so it never
+// appears in restic's environment, where it would be visible in
+// /proc/<pid>/environ and inherited by rclone or ssh. The returned cleanup
+// closes the parent's end of the pipe and must be called once the command has
+// finished.
+func addEnv(target *cfg.BackupTarget, cmd *exec.Cmd) (func(), error) {
+	backendVars, err := backendEnv(target)
+	if err != nil {
+		return nil, err
+	}
+
+	set := []string{"RESTIC_REPOSITORY"}
+	for _, kv := range backendVars {
+		name, _, _ := strings.Cut(kv, "=")
+		set = append(set, name)
+	}
+
+	cmd.Env = FilterEnv(os.Environ(), set)
+	cmd.Env = append(cmd.Env, "RESTIC_REPOSITORY="+target.ResticRepository)
+	cmd.Env = append(cmd.Env, backendVars...)
+
+	if target.CACertPath != "" {
+		cmd.Env = append(cmd.Env, "RESTIC_CACERT="+os.ExpandEnv(target.CACertPath))
+	}
+
+	if target.ResticPassword == "" {
+		return func() {}, nil
+	}
+
+	return passwordFile(cmd, "--password-file", target.ResticPassword)
+}
+
+// backendEnv returns the AWS fields and env variables of target as NAME=value
+// pairs. Everything the target sets is passed on, whatever its repository
+// looks like: an s3-compatible server behind rest: or an rclone remote may
+// well need the AWS variables.
+func backendEnv(target *cfg.BackupTarget) ([]string, error) {
+	vars := map[string]string{}
+	for name, value := range target.Env {
+		if name == "RESTIC_REPOSITORY" || name == "RESTIC_PASSWORD" {
+			return nil, fmt.Errorf("%s must be set with the target field, not in env", name)
+		}
+		vars[name] = value
+	}
+	if target.AwsAccessKeyId != "" {
+		vars["AWS_ACCESS_KEY_ID"] = target.AwsAccessKeyId
+	}
+	if target.AwsSecretAccessKey != "" {
+		vars["AWS_SECRET_ACCESS_KEY"] = target.AwsSecretAccessKey
+	}
+
+	var result []string
+	for _, name := range sortedKeys(vars) {
+		result = append(result, name+"="+vars[name])
+	}
+	return result, nil
+}
+
+// passwordFile passes password to cmd through an inherited pipe and adds
+// flag with the pipe's /dev/fd path to its arguments.
+func passwordFile(cmd *exec.Cmd, flag string, password string) (func(), error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "create password pipe")
+	}
+
+	// the password is far smaller than the pipe buffer, so this never blocks
+	_, err = w.WriteString(password)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		r.Close()
+		return nil, errors.Wrap(err, "write password pipe")
+	}
+
+	// ExtraFiles[i] becomes file descriptor 3+i in the child
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+	cmd.Args = append(
+		[]string{cmd.Args[0], flag, fmt.Sprintf("/dev/fd/%d", fd)},
+		cmd.Args[1:]...,
+	)
+
+	return func() { r.Close() }, nil
+}
+
+// FilterEnv returns env without the variables in names, which are about to
+// be set, the restic settings in inheritedVars and the secret variables of
+// KnownEnvVars.
+func FilterEnv(env []string, names []string) []string {
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if lo.Contains(names, name) || lo.Contains(inheritedVars, name) {
+			continue
+		}
+		if v, known := LookupEnvVar(name); known && v.Secret {
+			continue
+		}
+		result = append(result, kv)
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package restic
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddEnv(t *testing.T) {
+	opts, _ := fakeRestic(t, `echo "$passwords $*"
+echo "password=${RESTIC_PASSWORD-unset} repo=$RESTIC_REPOSITORY aws=${AWS_SECRET_ACCESS_KEY-unset} b2=${B2_ACCOUNT_KEY-unset} profile=${AWS_PROFILE-unset}"
+`)
+
+	t.Setenv("RESTIC_PASSWORD", "inherited")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "inherited")
+	t.Setenv("B2_ACCOUNT_KEY", "inherited")
+	t.Setenv("AWS_PROFILE", "work")
+
+	run := func(target *cfg.BackupTarget) string {
+		cmd := exec.Command(opts.ResticPath, "snapshots")
+		cleanup, err := addEnv(target, cmd)
+		require.NoError(t, err)
+		defer cleanup()
+
+		out, err := cmd.Output()
+		require.NoError(t, err)
+		return string(out)
+	}
+
+	out := run(&cfg.BackupTarget{
+		ResticRepository: "/srv/restic",
+		ResticPassword:   "s3cret",
+	})
+	assert.Equal(t, " --password-file=s3cret snapshots\n"+
+		"password=unset repo=/srv/restic aws=unset b2=unset profile=work\n", out)
+
+	out = run(&cfg.BackupTarget{
+		ResticRepository:   "s3:s3.amazonaws.com/bucket",
+		ResticPassword:     "s3cret",
+		AwsSecretAccessKey: "aws-secret",
+		Env:                map[string]string{"AWS_PROFILE": "backup"},
+	})
+	assert.Equal(t, " --password-file=s3cret snapshots\n"+
+		"password=unset repo=s3:s3.amazonaws.com/bucket aws=aws-secret b2=unset profile=backup\n", out)
+
+	out = run(&cfg.BackupTarget{
+		ResticRepository: "b2:bucket:path",
+		ResticPassword:   "s3cret",
+		Env:              map[string]string{"B2_ACCOUNT_KEY": "b2-secret"},
+	})
+	assert.Equal(t, " --password-file=s3cret snapshots\n"+
+		"password=unset repo=b2:bucket:path aws=unset b2=b2-secret profile=work\n", out)
+
+	// the AWS variables are passed on for backends that aren't s3: on the
+	// surface
+	out = run(&cfg.BackupTarget{
+		ResticRepository:   "rclone:minio:bucket/repo",
+		ResticPassword:     "s3cret",
+		AwsSecretAccessKey: "aws-secret",
+		Env:                map[string]string{"AWS_PROFILE": "minio"},
+	})
+	assert.Equal(t, " --password-file=s3cret snapshots\n"+
+		"password=unset repo=rclone:minio:bucket/repo aws=aws-secret b2=unset profile=minio\n", out)
+
+	cmd := exec.Command(opts.ResticPath)
+	_, err := addEnv(&cfg.BackupTarget{
+		ResticRepository: "/srv/restic",
+		Env:              map[string]string{"RESTIC_PASSWORD": "s3cret"},
+	}, cmd)
+	assert.EqualError(t, err, "RESTIC_PASSWORD must be set with the target field, not in env")
+}
@@ -0,0 +1,208 @@
+package restic
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Meta identifies where and when a message was emitted.
+type Meta struct {
+	RunID           string    `json:"run_id"`
+	Job             string    `json:"job,omitempty"`
+	Target          string    `json:"target,omitempty"`
+	KeychainProfile string    `json:"keychain_profile,omitempty"`
+	Repository      string    `json:"repository,omitempty"`
+	Seq             uint64    `json:"seq"`
+	Time            time.Time `json:"time"`
+}
+
+// Envelope wraps every message passed to the callbacks of Run, BackupOne and
+// InitRepo.
+type Envelope struct {
+	Meta
+	Type    string `json:"type"`
+	Message any    `json:"message"`
+}
+
+// Unwrap returns the metadata and the message carried by msg. Messages that
+// aren't wrapped in an Envelope are returned as-is with empty metadata.
+func Unwrap(msg any) (Meta, any) {
+	if env, ok := msg.(Envelope); ok {
+		return env.Meta, env.Message
+	}
+	return Meta{}, msg
+}
+
+// MessageType returns the Envelope type name of msg.
+func MessageType(msg any) string {
+	switch msg.(type) {
+	case StartBackup:
+		return "start"
+	case ResticStatus:
+		return "status"
+	case ResticSummary:
+		return "summary"
+	case ResticInitialized:
+		return "initialized"
+	case StderrLine:
+		return "stderr"
+	case PingFailed:
+		return "ping_failed"
+	case TargetDone:
+		return "target_done"
+	case CopyDone:
+		return "copy_done"
+	case RunDone:
+		return "run_done"
+	case ErrorMessage:
+		return "error"
+	default:
+		return fmt.Sprintf("%T", msg)
+	}
+}
+
+// DecodeEnvelope decodes a JSON encoded Envelope, restoring the concrete type
+// of its message.
+func DecodeEnvelope(data []byte) (Envelope, error) {
+	var raw struct {
+		Meta
+		Type    string          `json:"type"`
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Envelope{}, err
+	}
+
+	var msg any
+	var err error
+	switch raw.Type {
+	case "start":
+		msg, err = decodeAs[StartBackup](raw.Message)
+	case "status":
+		msg, err = decodeAs[ResticStatus](raw.Message)
+	case "summary":
+		msg, err = decodeAs[ResticSummary](raw.Message)
+	case "initialized":
+		msg, err = decodeAs[ResticInitialized](raw.Message)
+	case "stderr":
+		msg, err = decodeAs[StderrLine](raw.Message)
+	case "ping_failed":
+		msg, err = decodeAs[PingFailed](raw.Message)
+	case "target_done":
+		msg, err = decodeAs[TargetDone](raw.Message)
+	case "copy_done":
+		msg, err = decodeAs[CopyDone](raw.Message)
+	case "run_done":
+		msg, err = decodeAs[RunDone](raw.Message)
+	case "error":
+		msg, err = decodeAs[ErrorMessage](raw.Message)
+	default:
+		return Envelope{}, fmt.Errorf("unknown message type %s", raw.Type)
+	}
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{Meta: raw.Meta, Type: raw.Type, Message: msg}, nil
+}
+
+func decodeAs[T any](data []byte) (any, error) {
+	var result T
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// run numbers and timestamps the messages of one invocation and serialises
+// calls to the user callback.
+type run struct {
+	mu       sync.Mutex
+	id       string
+	job      string
+	seq      uint64
+	callback func(any) error
+	redactor *Redactor
+	now      func() time.Time
+}
+
+func newRun(opts *cfg.BackupConfig, callback func(any) error) *run {
+	return &run{
+		id:       newRunID(time.Now()),
+		job:      opts.Job,
+		callback: callback,
+		redactor: NewRedactor(opts.Targets...),
+		now:      time.Now,
+	}
+}
+
+// newRunID returns a unique id that sorts by start time.
+func newRunID(now time.Time) string {
+	var suffix [4]byte
+	_, _ = rand.Read(suffix[:])
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix[:])
+}
+
+func (r *run) emit(meta Meta, msg any) error {
+	if r == nil || r.callback == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	meta.RunID = r.id
+	meta.Job = r.job
+	meta.Seq = r.seq
+	meta.Time = r.now()
+
+	return r.callback(r.redactor.Message(Envelope{
+		Meta:    meta,
+		Type:    MessageType(msg),
+		Message: msg,
+	}))
+}
+
+// callbackFor returns a callback that emits messages on behalf of target, or
+// on behalf of the whole run when target is nil.
+func (r *run) callbackFor(target *cfg.BackupTarget) func(any) error {
+	if target != nil {
+		r.redactor.Add(*target)
+	}
+
+	meta := targetMeta(target)
+	return func(msg any) error {
+		return r.emit(meta, msg)
+	}
+}
+
+func targetMeta(target *cfg.BackupTarget) Meta {
+	if target == nil {
+		return Meta{}
+	}
+
+	meta := Meta{
+		Target:          target.Name,
+		KeychainProfile: target.KeychainProfile,
+	}
+	if meta.Target == "" {
+		meta.Target = target.KeychainProfile
+	}
+	if masked, err := MaskRepository(target.ResticRepository); err == nil {
+		meta.Repository = masked
+	}
+
+	return meta
+}
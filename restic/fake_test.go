@@ -0,0 +1,59 @@
+package restic
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResticPrelude starts every fake restic. It reads the password file
+// flags, which come before the command, into $password, $new_password and
+// $from_password, and appends the command line to $dir/log with the password
+// files replaced by their contents. $@ is left holding the command.
+const fakeResticPrelude = `#!/bin/sh
+dir=$(dirname "$0")
+passwords=""
+while :; do
+	case "$1" in
+	--password-file|--new-password-file|--from-password-file) value=$(cat "$2") ;;
+	*) break ;;
+	esac
+	case "$1" in
+	--password-file) password=$value ;;
+	--new-password-file) new_password=$value ;;
+	--from-password-file) from_password=$value ;;
+	esac
+	passwords="$passwords $1=$value"
+	shift 2
+done
+echo "$passwords $*" >> "$dir/log"
+`
+
+// fakeRestic writes a restic stand-in running body after fakeResticPrelude
+// to a temporary directory. It returns a config using it and the directory,
+// where body may keep its state.
+func fakeRestic(t *testing.T, body string) (*cfg.BackupConfig, string) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	require.NoError(t, os.WriteFile(script, []byte(fakeResticPrelude+body), 0o755))
+	return &cfg.BackupConfig{ResticPath: script}, dir
+}
+
+// fakeResticLog returns the command lines the fake restic in dir was run
+// with, filtered to those containing match.
+func fakeResticLog(t *testing.T, dir string, match string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	require.NoError(t, err)
+
+	var result []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if strings.Contains(line, match) {
+			result = append(result, line)
+		}
+	}
+	return result
+}
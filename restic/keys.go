@@ -0,0 +1,112 @@
+package restic
+
+import (
+	"os/exec"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+)
+
+// ResticKey is an element of the output of "restic key list --json".
+type ResticKey struct {
+	Current  bool   `json:"current"`
+	ID       string `json:"id"`
+	UserName string `json:"userName"`
+	HostName string `json:"hostName"`
+	Created  string `json:"created"`
+}
+
+// KeyAddOptions describes a key to add to a repository. Host and User
+// default to the local host and user.
+type KeyAddOptions struct {
+	NewPassword string
+	Host        string
+	User        string
+}
+
+// KeyList lists the keys of the repository of target.
+func KeyList(opts *cfg.BackupConfig, target *cfg.BackupTarget) ([]ResticKey, error) {
+	target, err := resolveTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return keyList(opts, target)
+}
+
+func keyList(opts *cfg.BackupConfig, target *cfg.BackupTarget) ([]ResticKey, error) {
+	cmd := exec.Command(opts.ResticPath, "key", "list", "--json")
+
+	var keys []ResticKey
+	if err := jsonResticCommand(target, cmd, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// KeyAdd adds a key with a new password to the repository of target.
+func KeyAdd(opts *cfg.BackupConfig, target *cfg.BackupTarget, key KeyAddOptions) error {
+	target, err := resolveTarget(target)
+	if err != nil {
+		return err
+	}
+	return keyAdd(opts, target, key)
+}
+
+func keyAdd(opts *cfg.BackupConfig, target *cfg.BackupTarget, key KeyAddOptions) error {
+	args := []string{"key", "add"}
+	if key.Host != "" {
+		args = append(args, "--host", key.Host)
+	}
+	if key.User != "" {
+		args = append(args, "--user", key.User)
+	}
+
+	cmd := exec.Command(opts.ResticPath, args...)
+	return newPasswordCommand(target, cmd, key.NewPassword)
+}
+
+// KeyRemove removes the key with the given id from the repository of
+// target. restic refuses to remove the key target opens the repository with.
+func KeyRemove(opts *cfg.BackupConfig, target *cfg.BackupTarget, id string) error {
+	target, err := resolveTarget(target)
+	if err != nil {
+		return err
+	}
+	return keyRemove(opts, target, id)
+}
+
+func keyRemove(opts *cfg.BackupConfig, target *cfg.BackupTarget, id string) error {
+	cmd := exec.Command(opts.ResticPath, "key", "remove", id)
+	_, err := runResticCommand(target, cmd)
+	return err
+}
+
+// KeyPasswd changes the password of the key target opens the repository
+// with.
+func KeyPasswd(opts *cfg.BackupConfig, target *cfg.BackupTarget, newPassword string) error {
+	target, err := resolveTarget(target)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(opts.ResticPath, "key", "passwd")
+	return newPasswordCommand(target, cmd, newPassword)
+}
+
+// newPasswordCommand runs a restic command that takes a new password through
+// --new-password-file.
+func newPasswordCommand(target *cfg.BackupTarget, cmd *exec.Cmd, newPassword string) error {
+	if newPassword == "" {
+		return errors.New("new password must not be empty")
+	}
+
+	cleanup, err := passwordFile(cmd, "--new-password-file", newPassword)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	_, err = runResticCommand(target, cmd)
+	return NewRedactor(cfg.BackupTarget{ResticPassword: newPassword}).Error(err)
+}
@@ -0,0 +1,46 @@
+package restic
+
+import (
+	"testing"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	opts, dir := fakeRestic(t, `case "$*" in
+"key list"*) echo '[{"current":true,"id":"4a2b","userName":"alice","hostName":"laptop","created":"2024-05-01 12:00:00"}]' ;;
+"key remove bad") echo "Fatal: key bad not found" >&2; exit 1 ;;
+esac
+`)
+	target := &cfg.BackupTarget{ResticRepository: "/srv/restic", ResticPassword: "old-password"}
+
+	keys, err := KeyList(opts, target)
+	require.NoError(t, err)
+	assert.Equal(t, []ResticKey{{
+		Current:  true,
+		ID:       "4a2b",
+		UserName: "alice",
+		HostName: "laptop",
+		Created:  "2024-05-01 12:00:00",
+	}}, keys)
+
+	require.NoError(t, KeyAdd(opts, target, KeyAddOptions{NewPassword: "new-password", Host: "nas", User: "bob"}))
+	require.NoError(t, KeyPasswd(opts, target, "new-password"))
+	require.NoError(t, KeyRemove(opts, target, "4a2b"))
+
+	err = KeyRemove(opts, target, "bad")
+	assert.ErrorContains(t, err, "Fatal: key bad not found")
+
+	err = KeyAdd(opts, target, KeyAddOptions{})
+	assert.EqualError(t, err, "new password must not be empty")
+
+	assert.Equal(t, []string{
+		" --password-file=old-password key list --json",
+		" --password-file=old-password --new-password-file=new-password key add --host nas --user bob",
+		" --password-file=old-password --new-password-file=new-password key passwd",
+		" --password-file=old-password key remove 4a2b",
+		" --password-file=old-password key remove bad",
+	}, fakeResticLog(t, dir, ""))
+}
@@ -0,0 +1,134 @@
+package restic
+
+import (
+	"github.com/minor-industries/backup/cfg"
+)
+
+// Observer receives the messages emitted by Run, BackupOne and InitRepo
+// together with the metadata of their envelope. Embed BaseObserver to only
+// implement the methods you care about; when a message type is added,
+// existing observers keep compiling and ignore it.
+type Observer interface {
+	OnStart(meta Meta, msg StartBackup) error
+	OnStatus(meta Meta, msg ResticStatus) error
+	OnSummary(meta Meta, msg ResticSummary) error
+	OnInitialized(meta Meta, msg ResticInitialized) error
+	OnStderr(meta Meta, msg StderrLine) error
+	OnPingFailed(meta Meta, msg PingFailed) error
+	OnTargetDone(meta Meta, msg TargetDone) error
+	OnCopyDone(meta Meta, msg CopyDone) error
+	OnRunDone(meta Meta, msg RunDone) error
+	OnError(meta Meta, msg ErrorMessage) error
+}
+
+type BaseObserver struct{}
+
+func (BaseObserver) OnStart(Meta, StartBackup) error             { return nil }
+func (BaseObserver) OnStatus(Meta, ResticStatus) error           { return nil }
+func (BaseObserver) OnSummary(Meta, ResticSummary) error         { return nil }
+func (BaseObserver) OnInitialized(Meta, ResticInitialized) error { return nil }
+func (BaseObserver) OnStderr(Meta, StderrLine) error             { return nil }
+func (BaseObserver) OnPingFailed(Meta, PingFailed) error         { return nil }
+func (BaseObserver) OnTargetDone(Meta, TargetDone) error         { return nil }
+func (BaseObserver) OnCopyDone(Meta, CopyDone) error             { return nil }
+func (BaseObserver) OnRunDone(Meta, RunDone) error               { return nil }
+func (BaseObserver) OnError(Meta, ErrorMessage) error            { return nil }
+
+// Dispatch calls the Observer method matching the type of msg, which may be
+// wrapped in an Envelope. Messages of other types are ignored.
+func Dispatch(o Observer, msg any) error {
+	meta, msg := Unwrap(msg)
+	switch msg := msg.(type) {
+	case StartBackup:
+		return o.OnStart(meta, msg)
+	case ResticStatus:
+		return o.OnStatus(meta, msg)
+	case ResticSummary:
+		return o.OnSummary(meta, msg)
+	case ResticInitialized:
+		return o.OnInitialized(meta, msg)
+	case StderrLine:
+		return o.OnStderr(meta, msg)
+	case PingFailed:
+		return o.OnPingFailed(meta, msg)
+	case TargetDone:
+		return o.OnTargetDone(meta, msg)
+	case CopyDone:
+		return o.OnCopyDone(meta, msg)
+	case RunDone:
+		return o.OnRunDone(meta, msg)
+	case ErrorMessage:
+		return o.OnError(meta, msg)
+	default:
+		// e.g. a message type newer than the observer
+		return nil
+	}
+}
+
+// Callback adapts an Observer to the func(any) error form taken by Run,
+// BackupOne and InitRepo.
+func Callback(o Observer) func(msg any) error {
+	return func(msg any) error {
+		return Dispatch(o, msg)
+	}
+}
+
+// ObserverFunc adapts a func(any) error callback to an Observer. Messages are
+// passed to the callback wrapped in an Envelope.
+func ObserverFunc(callback func(msg any) error) Observer {
+	return funcObserver(callback)
+}
+
+type funcObserver func(msg any) error
+
+func (f funcObserver) call(meta Meta, msg any) error {
+	return f(Envelope{Meta: meta, Type: MessageType(msg), Message: msg})
+}
+
+func (f funcObserver) OnStart(meta Meta, msg StartBackup) error     { return f.call(meta, msg) }
+func (f funcObserver) OnStatus(meta Meta, msg ResticStatus) error   { return f.call(meta, msg) }
+func (f funcObserver) OnSummary(meta Meta, msg ResticSummary) error { return f.call(meta, msg) }
+func (f funcObserver) OnInitialized(meta Meta, msg ResticInitialized) error {
+	return f.call(meta, msg)
+}
+func (f funcObserver) OnStderr(meta Meta, msg StderrLine) error     { return f.call(meta, msg) }
+func (f funcObserver) OnPingFailed(meta Meta, msg PingFailed) error { return f.call(meta, msg) }
+func (f funcObserver) OnTargetDone(meta Meta, msg TargetDone) error { return f.call(meta, msg) }
+func (f funcObserver) OnCopyDone(meta Meta, msg CopyDone) error     { return f.call(meta, msg) }
+func (f funcObserver) OnRunDone(meta Meta, msg RunDone) error       { return f.call(meta, msg) }
+func (f funcObserver) OnError(meta Meta, msg ErrorMessage) error    { return f.call(meta, msg) }
+
+// Tee forwards every message to all observers in order and returns the first
+// error. Later observers still see the message when an earlier one fails.
+func Tee(observers ...Observer) Observer {
+	return ObserverFunc(func(msg any) error {
+		var firstErr error
+		for _, o := range observers {
+			if err := Dispatch(o, msg); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	})
+}
+
+// Filter forwards only the messages for which keep returns true.
+func Filter(keep func(msg any) bool, next Observer) Observer {
+	return ObserverFunc(func(msg any) error {
+		if !keep(msg) {
+			return nil
+		}
+		return Dispatch(next, msg)
+	})
+}
+
+// Throttle is ThrottleFilter for observers.
+func Throttle(opts cfg.ProgressConfig, next Observer) Observer {
+	return ObserverFunc(ThrottleFilter(opts, Callback(next)))
+}
+
+// Log formats every message as a line of text, like LogMessages but without
+// throttling; combine with Throttle as needed.
+func Log(callback func(msg string) error) Observer {
+	return ObserverFunc(logMessages(callback))
+}
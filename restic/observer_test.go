@@ -0,0 +1,66 @@
+package restic
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type summaryObserver struct {
+	BaseObserver
+	snapshots []string
+}
+
+func (o *summaryObserver) OnSummary(meta Meta, msg ResticSummary) error {
+	o.snapshots = append(o.snapshots, meta.Target+":"+msg.SnapshotID)
+	return nil
+}
+
+func TestObserver(t *testing.T) {
+	summaries := &summaryObserver{}
+
+	var all []any
+	failing := ObserverFunc(func(msg any) error {
+		_, inner := Unwrap(msg)
+		all = append(all, inner)
+		return errors.New("boom")
+	})
+
+	callback := Callback(Tee(
+		failing,
+		Filter(func(msg any) bool {
+			_, inner := Unwrap(msg)
+			_, isStatus := inner.(ResticStatus)
+			return !isStatus
+		}, summaries),
+	))
+
+	require.EqualError(t, callback(StartBackup{Repository: "/repo"}), "boom")
+	require.EqualError(t, callback(ResticStatus{PercentDone: 0.5}), "boom")
+	require.EqualError(t, callback(Envelope{
+		Meta:    Meta{Target: "nas"},
+		Message: ResticSummary{SnapshotID: "abcd"},
+	}), "boom")
+
+	assert.Equal(t, []any{
+		StartBackup{Repository: "/repo"},
+		ResticStatus{PercentDone: 0.5},
+		ResticSummary{SnapshotID: "abcd"},
+	}, all)
+	assert.Equal(t, []string{"nas:abcd"}, summaries.snapshots)
+
+}
+
+func TestObserverIgnoresUnknownMessages(t *testing.T) {
+	type futureMessage struct{ Value int }
+
+	summaries := &summaryObserver{}
+	callback := Callback(summaries)
+
+	assert.NoError(t, callback(futureMessage{Value: 1}))
+	assert.NoError(t, callback(Envelope{Meta: Meta{Target: "nas"}, Message: futureMessage{Value: 2}}))
+	require.NoError(t, callback(ResticSummary{SnapshotID: "abcd"}))
+	assert.Equal(t, []string{":abcd"}, summaries.snapshots)
+}
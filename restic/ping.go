@@ -0,0 +1,130 @@
+package restic
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPingTimeout = 10 * time.Second
+	defaultPingRetries = 2
+	maxPingBodySize    = 10 * 1024
+)
+
+// pinger reports run progress to a healthchecks-compatible service. Failures
+// to reach the service are passed to warn and never abort the backup.
+type pinger struct {
+	start   string
+	success string
+	fail    string
+	retries int
+	client  *http.Client
+	warn    func(PingFailed)
+	backoff time.Duration
+}
+
+func newPinger(opts cfg.PingConfig, warn func(PingFailed)) *pinger {
+	p := &pinger{
+		start:   opts.StartURL,
+		success: opts.SuccessURL,
+		fail:    opts.FailURL,
+		retries: opts.Retries,
+		client:  &http.Client{Timeout: opts.Timeout},
+		warn:    warn,
+		backoff: time.Second,
+	}
+
+	if base := strings.TrimSuffix(opts.URL, "/"); base != "" {
+		if p.start == "" {
+			p.start = base + "/start"
+		}
+		if p.success == "" {
+			p.success = base
+		}
+		if p.fail == "" {
+			p.fail = base + "/fail"
+		}
+	}
+
+	if p.retries == 0 {
+		p.retries = defaultPingRetries
+	}
+	p.retries = max(p.retries, 0)
+	if p.client.Timeout <= 0 {
+		p.client.Timeout = defaultPingTimeout
+	}
+
+	return p
+}
+
+func (p *pinger) Start() {
+	p.ping("start", p.start, "")
+}
+
+func (p *pinger) Success(body string) {
+	p.ping("success", p.success, body)
+}
+
+func (p *pinger) Fail(body string) {
+	p.ping("fail", p.fail, body)
+}
+
+func (p *pinger) ping(event string, url string, body string) {
+	if url == "" {
+		return
+	}
+
+	if len(body) > maxPingBodySize {
+		body = body[:maxPingBodySize]
+	}
+
+	var err error
+	// the first attempt plus the retries
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.backoff * time.Duration(attempt))
+		}
+		if err = p.post(url, body); err == nil {
+			return
+		}
+	}
+
+	if p.warn != nil {
+		p.warn(PingFailed{Event: event, Error: err.Error()})
+	}
+}
+
+func (p *pinger) post(url string, body string) error {
+	resp, err := p.client.Post(url, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "post")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+func summaryText(summaries []ResticSummary) string {
+	var sb strings.Builder
+	for _, s := range summaries {
+		fmt.Fprintf(&sb,
+			"snapshot %s: %d new, %d changed, %d unmodified files, %d bytes added in %.1fs\n",
+			s.SnapshotID,
+			s.FilesNew,
+			s.FilesChanged,
+			s.FilesUnmodified,
+			s.DataAdded,
+			s.TotalDuration,
+		)
+	}
+	return sb.String()
+}
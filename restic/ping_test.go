@@ -0,0 +1,82 @@
+package restic
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinger(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	var bodies []string
+	failures := 1
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, string(body))
+	}))
+	defer srv.Close()
+
+	var warnings []PingFailed
+	p := newPinger(cfg.PingConfig{URL: srv.URL + "/uuid/"}, func(msg PingFailed) {
+		warnings = append(warnings, msg)
+	})
+	p.backoff = time.Millisecond
+
+	p.Start()
+	p.Fail("boom")
+
+	assert.Equal(t, []string{"/uuid/start", "/uuid/fail"}, paths)
+	assert.Equal(t, []string{"", "boom"}, bodies)
+	assert.Empty(t, warnings)
+}
+
+func TestPingerUnreachable(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	var warnings []PingFailed
+	p := newPinger(cfg.PingConfig{
+		SuccessURL: srv.URL,
+		Timeout:    10 * time.Millisecond,
+		Retries:    2,
+	}, func(msg PingFailed) {
+		warnings = append(warnings, msg)
+	})
+	p.backoff = time.Millisecond
+
+	p.Start() // no start URL configured
+	p.Success("done")
+
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "success", warnings[0].Event)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, attempts, "the first attempt and two retries")
+}
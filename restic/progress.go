@@ -0,0 +1,226 @@
+package restic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"golang.org/x/term"
+)
+
+const (
+	progressBarWidth     = 20
+	progressRedrawPeriod = 100 * time.Millisecond
+	defaultTerminalWidth = 80
+)
+
+// ProgressRenderer returns a callback that draws a live, in-place progress
+// display on out. When out is not a terminal it falls back to the line based
+// output of ThrottledLogMessages.
+func ProgressRenderer(out *os.File, opts cfg.ProgressConfig) func(msg any) error {
+	if !term.IsTerminal(int(out.Fd())) {
+		return ThrottledLogMessages(opts, func(msg string) error {
+			_, err := fmt.Fprintln(out, msg)
+			return err
+		})
+	}
+
+	r := newProgressRenderer(out)
+	r.width = func() int { return terminalWidth(out) }
+	return r.handle
+}
+
+// terminalWidth returns the number of columns of the terminal f.
+func terminalWidth(f *os.File) int {
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil || width <= 0 {
+		return defaultTerminalWidth
+	}
+	return width
+}
+
+type progressRenderer struct {
+	w        io.Writer
+	now      func() time.Time
+	width    func() int
+	lastDraw time.Time
+	lines    int // number of lines of the live block currently on screen
+}
+
+func newProgressRenderer(w io.Writer) *progressRenderer {
+	return &progressRenderer{
+		w:     w,
+		now:   time.Now,
+		width: func() int { return defaultTerminalWidth },
+	}
+}
+
+func (r *progressRenderer) handle(msg any) error {
+	meta, msg := Unwrap(msg)
+
+	// several targets may be backed up in one run
+	var prefix string
+	if meta.Target != "" {
+		prefix = "[" + meta.Target + "] "
+	}
+	printLine := func(line string) error { return r.println(prefix + line) }
+
+	switch msg := msg.(type) {
+	case StartBackup:
+		if msg.KeychainProfile != "" {
+			return printLine(fmt.Sprintf("loading keychain profile: %s", msg.KeychainProfile))
+		}
+		if msg.Repository != "" {
+			r.lastDraw = time.Time{}
+			return printLine(fmt.Sprintf("starting backup: %s", msg.Repository))
+		}
+	case ResticStatus:
+		now := r.now()
+		if now.Sub(r.lastDraw) < progressRedrawPeriod {
+			return nil
+		}
+		r.lastDraw = now
+		return r.draw(progressLines(msg, prefix, r.width()))
+	case ResticSummary:
+		return printLine(fmt.Sprintf(
+			"backup done: snapshot %s, %d files processed, %s added in %s",
+			msg.SnapshotID,
+			msg.TotalFilesProcessed,
+			FormatBytes(msg.DataAdded),
+			time.Duration(msg.TotalDuration*float64(time.Second)).Round(time.Second),
+		))
+	case ResticInitialized:
+		return printLine(fmt.Sprintf("repository initialized: %s", msg.ID))
+	case StderrLine:
+		return printLine(fmt.Sprintf("restic: %s", msg.Line))
+	case PingFailed:
+		return printLine(fmt.Sprintf("ping %s failed: %s", msg.Event, msg.Error))
+	case TargetDone:
+		if msg.Error != "" {
+			return printLine(fmt.Sprintf("backup failed: %s", msg.Error))
+		}
+	case CopyDone:
+		if msg.Error != "" {
+			return printLine(fmt.Sprintf("copy from %s failed: %s", msg.From, msg.Error))
+		}
+		return printLine(fmt.Sprintf("copied %d snapshot(s) from %s to %s",
+			len(msg.Snapshots), msg.From, msg.Repository))
+	case ErrorMessage:
+		return printLine(fmt.Sprintf("error: %s", msg.Error))
+	case RunDone:
+		return printLine(fmt.Sprintf("run %s after %s", msg.Outcome,
+			time.Duration(msg.Duration*float64(time.Second)).Round(time.Second)))
+	}
+	return nil
+}
+
+// println replaces the live block with a permanent line of output.
+func (r *progressRenderer) println(line string) error {
+	r.clear()
+	_, err := fmt.Fprintln(r.w, line)
+	return err
+}
+
+func (r *progressRenderer) draw(lines []string) error {
+	r.clear()
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(r.w, "%s\n", line); err != nil {
+			return err
+		}
+	}
+	r.lines = len(lines)
+	return nil
+}
+
+func (r *progressRenderer) clear() {
+	if r.lines == 0 {
+		return
+	}
+	// move to the start of the block and erase to the end of the screen
+	fmt.Fprintf(r.w, "\033[%dA\r\033[J", r.lines)
+	r.lines = 0
+}
+
+// progressLines returns the live block for msg, every line starting with
+// prefix. Every line is shorter than width, as a wrapped line would throw off
+// the cursor movement of the next redraw.
+func progressLines(msg ResticStatus, prefix string, width int) []string {
+	// leave the last column free, some terminals wrap when it is written
+	maxWidth := max(width-1, 10)
+
+	filled := int(msg.PercentDone * progressBarWidth)
+	filled = max(0, min(filled, progressBarWidth))
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	line := prefix + fmt.Sprintf("[%s] %5.1f%%  %d/%d files  %s/%s",
+		bar,
+		msg.PercentDone*100,
+		msg.FilesDone,
+		msg.TotalFiles,
+		FormatBytes(msg.BytesDone),
+		FormatBytes(msg.TotalBytes),
+	)
+
+	var rate, eta string
+	if msg.SecondsElapsed > 0 {
+		rate = fmt.Sprintf("  %s/s", FormatBytes(msg.BytesDone/int64(msg.SecondsElapsed)))
+	}
+	if d, ok := progressETA(msg); ok {
+		eta = fmt.Sprintf("  ETA %s", d)
+	}
+
+	// drop the rate rather than cut the ETA off when the line is too long
+	if len([]rune(line+rate+eta)) <= maxWidth {
+		line += rate
+	}
+	line += eta
+
+	lines := []string{truncate(line, maxWidth)}
+	fileWidth := max(maxWidth-len([]rune(prefix))-2, 8)
+	for _, file := range msg.CurrentFiles {
+		// the end of a path says more than its start
+		if runes := []rune(file); len(runes) > fileWidth {
+			file = "..." + string(runes[len(runes)-(fileWidth-3):])
+		}
+		lines = append(lines, truncate(prefix+"  "+file, maxWidth))
+	}
+
+	return lines
+}
+
+func truncate(s string, width int) string {
+	if runes := []rune(s); len(runes) > width {
+		return string(runes[:width])
+	}
+	return s
+}
+
+func progressETA(msg ResticStatus) (time.Duration, bool) {
+	if msg.SecondsRemaining > 0 {
+		return time.Duration(msg.SecondsRemaining) * time.Second, true
+	}
+
+	if msg.SecondsElapsed == 0 || msg.BytesDone == 0 || msg.TotalBytes <= msg.BytesDone {
+		return 0, false
+	}
+
+	rate := float64(msg.BytesDone) / float64(msg.SecondsElapsed)
+	remaining := float64(msg.TotalBytes-msg.BytesDone) / rate
+	return time.Duration(remaining * float64(time.Second)).Round(time.Second), true
+}
+
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
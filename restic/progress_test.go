@@ -0,0 +1,72 @@
+package restic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressRenderer(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Unix(0, 0)
+
+	r := newProgressRenderer(&out)
+	r.now = func() time.Time { return now }
+
+	meta := Meta{Target: "nas"}
+	require.NoError(t, r.handle(StartBackup{Repository: "/repo"}))
+	require.NoError(t, r.handle(Envelope{Meta: meta, Message: ResticStatus{
+		SecondsElapsed: 10,
+		PercentDone:    0.5,
+		TotalFiles:     4,
+		FilesDone:      2,
+		TotalBytes:     20 * 1024 * 1024,
+		BytesDone:      10 * 1024 * 1024,
+		CurrentFiles:   []string{"/src/a.txt"},
+	}}))
+
+	assert.Equal(t, "starting backup: /repo\n"+
+		"[nas] [==========          ]  50.0%  2/4 files  10.0 MiB/20.0 MiB  ETA 10s\n"+
+		"[nas]   /src/a.txt\n",
+		out.String(),
+	)
+	assert.Equal(t, 2, r.lines)
+
+	// redraws within the redraw period are dropped
+	out.Reset()
+	require.NoError(t, r.handle(ResticStatus{PercentDone: 0.6}))
+	assert.Empty(t, out.String())
+
+	out.Reset()
+	require.NoError(t, r.handle(Envelope{Meta: meta, Message: ResticSummary{SnapshotID: "abcd", TotalFilesProcessed: 4, DataAdded: 2048, TotalDuration: 12}}))
+	assert.Equal(t, "\033[2A\r\033[J[nas] backup done: snapshot abcd, 4 files processed, 2.0 KiB added in 12s\n", out.String())
+	assert.Equal(t, 0, r.lines)
+}
+
+func TestProgressLinesFitWidth(t *testing.T) {
+	msg := ResticStatus{
+		SecondsElapsed: 3600,
+		PercentDone:    0.25,
+		TotalFiles:     1234567,
+		FilesDone:      123456,
+		TotalBytes:     4 << 40,
+		BytesDone:      1 << 40,
+		CurrentFiles:   []string{"/home/alice/" + strings.Repeat("very-long-directory/", 10) + "file.txt"},
+	}
+
+	for _, prefix := range []string{"", "[offsite-backblaze] "} {
+		for _, width := range []int{40, 80, 200} {
+			lines := progressLines(msg, prefix, width)
+			require.Len(t, lines, 2)
+			for _, line := range lines {
+				assert.Less(t, len(line), width, line)
+				assert.True(t, strings.HasPrefix(line, prefix), line)
+			}
+			assert.True(t, strings.HasSuffix(lines[1], "file.txt"))
+		}
+	}
+}
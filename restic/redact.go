@@ -0,0 +1,177 @@
+package restic
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/minor-industries/backup/cfg"
+)
+
+const redacted = "XXXX"
+
+// minSecretLength is the length below which values that only look like
+// secrets, by the name of their variable or their place in a repository URL,
+// are not replaced in free text; replacing every "1" or "ab" would garble
+// every message. Secrets the target configures as such are always replaced.
+const minSecretLength = 4
+
+// Redactor scrubs the secrets of a set of targets (passwords, backend
+// credentials and repository URL credentials) from text, errors and messages.
+type Redactor struct {
+	mu       sync.RWMutex
+	replacer *strings.Replacer
+	pairs    map[string]string
+}
+
+func NewRedactor(targets ...cfg.BackupTarget) *Redactor {
+	r := &Redactor{pairs: map[string]string{}}
+	for _, target := range targets {
+		r.Add(target)
+	}
+	return r
+}
+
+// Add registers the secrets of target.
+func (r *Redactor) Add(target cfg.BackupTarget) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	secrets := []string{
+		target.ResticPassword,
+		target.AwsAccessKeyId,
+		target.AwsSecretAccessKey,
+	}
+	var guessed []string
+	for name, value := range target.Env {
+		if v, known := LookupEnvVar(name); known {
+			if v.Secret {
+				secrets = append(secrets, value)
+			}
+		} else if isSensitive(name) {
+			guessed = append(guessed, value)
+		}
+	}
+
+	if repo := target.ResticRepository; repo != "" {
+		if loc, err := ParseRepository(repo); err != nil {
+			r.pairs[repo] = redacted
+		} else {
+			if loc.String() != repo {
+				r.pairs[repo] = loc.String()
+			}
+			guessed = append(guessed, loc.secrets...)
+		}
+	}
+
+	for _, secret := range guessed {
+		if len(secret) >= minSecretLength {
+			secrets = append(secrets, secret)
+		}
+	}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		r.pairs[secret] = redacted
+		r.pairs[url.QueryEscape(secret)] = redacted
+		r.pairs[url.PathEscape(secret)] = redacted
+	}
+
+	// replace longer strings first so a raw repository URL is replaced by its
+	// masked form before the password inside it is
+	olds := make([]string, 0, len(r.pairs))
+	for old := range r.pairs {
+		olds = append(olds, old)
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+
+	args := make([]string, 0, 2*len(olds))
+	for _, old := range olds {
+		args = append(args, old, r.pairs[old])
+	}
+	r.replacer = strings.NewReplacer(args...)
+}
+
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Error returns err with a redacted message. The original error is still
+// available through errors.Is, errors.As and errors.Cause.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err, msg: r.String(err.Error())}
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+func (e *redactedError) Cause() error  { return e.err }
+
+// Message returns a copy of msg with all free-form text redacted.
+func (r *Redactor) Message(msg any) any {
+	switch msg := msg.(type) {
+	case Envelope:
+		msg.Repository = r.String(msg.Repository)
+		msg.Message = r.Message(msg.Message)
+		return msg
+	case StartBackup:
+		msg.Repository = r.String(msg.Repository)
+		return msg
+	case ResticInitialized:
+		msg.Repository = r.String(msg.Repository)
+		return msg
+	case StderrLine:
+		msg.Line = r.String(msg.Line)
+		return msg
+	case PingFailed:
+		msg.Error = r.String(msg.Error)
+		return msg
+	case TargetDone:
+		msg.Repository = r.String(msg.Repository)
+		msg.Error = r.String(msg.Error)
+		return msg
+	case CopyDone:
+		msg.Repository = r.String(msg.Repository)
+		msg.Error = r.String(msg.Error)
+		return msg
+	case RunDone:
+		msg.Error = r.String(msg.Error)
+		return msg
+	case ErrorMessage:
+		msg.Error = r.String(msg.Error)
+		return msg
+	default:
+		return msg
+	}
+}
+
+// Callback redacts every message before passing it on.
+func (r *Redactor) Callback(callback func(msg any) error) func(msg any) error {
+	return func(msg any) error {
+		return callback(r.Message(msg))
+	}
+}
@@ -0,0 +1,111 @@
+package restic
+
+import (
+	"fmt"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// Rotation reports the keys replaced by RotatePassword. Warning is set when
+// the old key may not have been removed.
+type Rotation struct {
+	OldKeyID string
+	NewKeyID string
+	Warning  string
+}
+
+// RotatePassword replaces the key target opens its repository with by a new
+// key with newPassword. It adds the new key, verifies that it opens the
+// repository, calls save with the new password so it can be stored, and only
+// then removes the old key. If a step before the removal fails, the new key
+// is removed again. Once the new password is saved, the rotation is kept: a
+// failed removal of the old key is only reported in Rotation.Warning.
+func RotatePassword(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	newPassword string,
+	save func(password string) error,
+) (*Rotation, error) {
+	target, err := resolveTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if newPassword == target.ResticPassword {
+		return nil, errors.New("new password is the same as the current one")
+	}
+
+	before, err := keyList(opts, target)
+	if err != nil {
+		return nil, errors.Wrap(err, "list keys")
+	}
+	oldKey, ok := lo.Find(before, func(k ResticKey) bool { return k.Current })
+	if !ok {
+		return nil, errors.New("cannot determine the current key")
+	}
+
+	if err := keyAdd(opts, target, KeyAddOptions{NewPassword: newPassword}); err != nil {
+		return nil, errors.Wrap(err, "add key")
+	}
+
+	newTarget := *target
+	newTarget.ResticPassword = newPassword
+
+	// from here on, failures have to remove the new key again
+	rotation := &Rotation{OldKeyID: oldKey.ID}
+	rollback := func(err error) (*Rotation, error) {
+		var failed []string
+		if rotation.NewKeyID != "" {
+			if removeErr := keyRemove(opts, target, rotation.NewKeyID); removeErr != nil {
+				failed = append(failed, fmt.Sprintf("remove new key %s: %s", rotation.NewKeyID, removeErr))
+			}
+		} else {
+			failed = append(failed, "new key unknown, it may have to be removed by hand")
+		}
+
+		if len(failed) > 0 {
+			err = errors.Wrapf(err, "rollback failed (%v)", failed)
+		}
+		return nil, NewRedactor(newTarget).Error(err)
+	}
+
+	// the new key is the current one when opening the repository with the
+	// new password
+	after, err := keyList(opts, &newTarget)
+	if err != nil {
+		// find the new key with the old password, to remove it
+		if withOld, listErr := keyList(opts, target); listErr == nil {
+			if newKey, ok := lo.Find(withOld, func(k ResticKey) bool {
+				return !lo.ContainsBy(before, func(b ResticKey) bool { return b.ID == k.ID })
+			}); ok {
+				rotation.NewKeyID = newKey.ID
+			}
+		}
+		return rollback(errors.Wrap(err, "verify new key"))
+	}
+
+	newKey, ok := lo.Find(after, func(k ResticKey) bool { return k.Current })
+	if !ok || newKey.ID == oldKey.ID {
+		return rollback(errors.New("verify new key: new password doesn't open the new key"))
+	}
+	rotation.NewKeyID = newKey.ID
+
+	if err := save(newPassword); err != nil {
+		return rollback(errors.Wrap(err, "save new password"))
+	}
+
+	// the new password may have been generated and never shown, so from here
+	// on going back would risk locking the user out
+	if err := keyRemove(opts, &newTarget, oldKey.ID); err != nil {
+		// the removal may have been applied even though it reported an error
+		keys, listErr := keyList(opts, &newTarget)
+		if listErr != nil || lo.ContainsBy(keys, func(k ResticKey) bool { return k.ID == oldKey.ID }) {
+			rotation.Warning = fmt.Sprintf("old key %s may still exist and should be removed: %s",
+				oldKey.ID, NewRedactor(*target, newTarget).String(err.Error()))
+		}
+	}
+
+	return rotation, nil
+}
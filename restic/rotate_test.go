@@ -0,0 +1,129 @@
+package restic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKeyStore keeps each key as a file named by its id and holding its
+// password.
+const fakeKeyStore = `keys=$dir/keys
+current=$(grep -lx -- "$password" "$keys"/* 2>/dev/null | head -1)
+[ -n "$current" ] || { echo "Fatal: wrong password or no key found" >&2; exit 12; }
+current=$(basename "$current")
+case "$1 $2" in
+"key list")
+	sep="["
+	for f in "$keys"/*; do
+		id=$(basename "$f")
+		printf '%s{"current":%s,"id":"%s"}' "$sep" "$([ "$id" = "$current" ] && echo true || echo false)" "$id"
+		sep=","
+	done
+	echo "]" ;;
+"key add")
+	echo "$new_password" > "$keys/k$(ls "$keys" | wc -l | tr -d ' ')" ;;
+"key remove")
+	[ "$3" = "$current" ] && { echo "Fatal: refusing to remove key currently used" >&2; exit 1; }
+	# fail-remove makes the removal fail, before or after it is applied
+	fail=$(cat "$dir/fail-remove" 2>/dev/null)
+	[ "$fail" = before ] && { echo "Fatal: connection reset" >&2; exit 1; }
+	rm "$keys/$3"
+	if [ "$fail" = after ]; then echo "Fatal: timeout" >&2; exit 1; fi ;;
+esac
+`
+
+func newFakeKeyStore(t *testing.T) (*cfg.BackupConfig, string) {
+	opts, dir := fakeRestic(t, fakeKeyStore)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "keys"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "keys", "k0"), []byte("old-password\n"), 0o600))
+	return opts, filepath.Join(dir, "keys")
+}
+
+func keyFiles(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	result := map[string]string{}
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		require.NoError(t, err)
+		result[e.Name()] = string(content)
+	}
+	return result
+}
+
+func TestRotatePassword(t *testing.T) {
+	opts, keys := newFakeKeyStore(t)
+	target := &cfg.BackupTarget{ResticRepository: "/srv/restic", ResticPassword: "old-password"}
+
+	var saved []string
+	rotation, err := RotatePassword(opts, target, "new-password", func(password string) error {
+		saved = append(saved, password)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, &Rotation{OldKeyID: "k0", NewKeyID: "k1"}, rotation)
+	assert.Equal(t, []string{"new-password"}, saved)
+	assert.Equal(t, map[string]string{"k1": "new-password\n"}, keyFiles(t, keys))
+}
+
+func TestRotatePasswordRollback(t *testing.T) {
+	opts, keys := newFakeKeyStore(t)
+	target := &cfg.BackupTarget{ResticRepository: "/srv/restic", ResticPassword: "old-password"}
+
+	cause := errors.New("keychain locked")
+	_, err := RotatePassword(opts, target, "new-password", func(password string) error {
+		return cause
+	})
+	assert.EqualError(t, err, "save new password: keychain locked")
+	assert.ErrorIs(t, err, cause)
+
+	// the new key is gone, the old one still works
+	assert.Equal(t, map[string]string{"k0": "old-password\n"}, keyFiles(t, keys))
+
+	_, err = RotatePassword(opts, target, "old-password", nil)
+	assert.EqualError(t, err, "new password is the same as the current one")
+}
+
+func TestRotatePasswordKeepsSavedPassword(t *testing.T) {
+	for _, tt := range []struct {
+		fail    string
+		keys    map[string]string
+		warning string
+	}{
+		{
+			fail:    "before",
+			keys:    map[string]string{"k0": "old-password\n", "k1": "new-password\n"},
+			warning: "old key k0 may still exist and should be removed: run (output: Fatal: connection reset\n): exit status 1",
+		},
+		{
+			fail: "after",
+			keys: map[string]string{"k1": "new-password\n"},
+		},
+	} {
+		t.Run(tt.fail, func(t *testing.T) {
+			opts, keys := newFakeKeyStore(t)
+			require.NoError(t, os.WriteFile(filepath.Join(keys, "..", "fail-remove"), []byte(tt.fail), 0o600))
+			target := &cfg.BackupTarget{ResticRepository: "/srv/restic", ResticPassword: "old-password"}
+
+			var saved []string
+			rotation, err := RotatePassword(opts, target, "new-password", func(password string) error {
+				saved = append(saved, password)
+				return nil
+			})
+			require.NoError(t, err)
+
+			// the new password is never replaced by the old one again
+			assert.Equal(t, []string{"new-password"}, saved)
+			assert.Equal(t, &Rotation{OldKeyID: "k0", NewKeyID: "k1", Warning: tt.warning}, rotation)
+			assert.Equal(t, tt.keys, keyFiles(t, keys))
+		})
+	}
+}
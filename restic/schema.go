@@ -3,6 +3,7 @@ package restic
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type ResticMessage struct {
@@ -10,13 +11,15 @@ type ResticMessage struct {
 }
 
 type ResticStatus struct {
-	MessageType  string   `json:"message_type"`
-	PercentDone  float64  `json:"percent_done"`
-	TotalFiles   int      `json:"total_files"`
-	FilesDone    int      `json:"files_done"`
-	TotalBytes   int64    `json:"total_bytes"`
-	BytesDone    int64    `json:"bytes_done"`
-	CurrentFiles []string `json:"current_files"`
+	MessageType      string   `json:"message_type"`
+	SecondsElapsed   int      `json:"seconds_elapsed"`
+	SecondsRemaining int      `json:"seconds_remaining"`
+	PercentDone      float64  `json:"percent_done"`
+	TotalFiles       int      `json:"total_files"`
+	FilesDone        int      `json:"files_done"`
+	TotalBytes       int64    `json:"total_bytes"`
+	BytesDone        int64    `json:"bytes_done"`
+	CurrentFiles     []string `json:"current_files"`
 }
 
 type ResticSummary struct {
@@ -40,7 +43,7 @@ type ResticSummary struct {
 type ResticInitialized struct {
 	MessageType string `json:"message_type"`
 	ID          string `json:"id"`
-	Repository  string `json:"repository"` // TODO: should mask passwords in these messages
+	Repository  string `json:"repository"`
 }
 
 type ResticStats struct {
@@ -49,11 +52,63 @@ type ResticStats struct {
 	SnapshotsCount int `json:"snapshots_count"`
 }
 
+type ResticSnapshot struct {
+	ID       string    `json:"id"`
+	ShortID  string    `json:"short_id"`
+	Time     time.Time `json:"time"`
+	Tree     string    `json:"tree"`
+	Parent   string    `json:"parent,omitempty"`
+	Paths    []string  `json:"paths"`
+	Hostname string    `json:"hostname"`
+	Username string    `json:"username,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Original string    `json:"original,omitempty"`
+}
+
 type StartBackup struct {
 	Repository      string `json:"repository,omitempty"`
 	KeychainProfile string `json:"keychain_profile,omitempty"`
 }
 
+type TargetDone struct {
+	Repository      string  `json:"repository,omitempty"`
+	KeychainProfile string  `json:"keychain_profile,omitempty"`
+	SnapshotID      string  `json:"snapshot_id,omitempty"`
+	Outcome         string  `json:"outcome"`
+	Duration        float64 `json:"duration"`
+	Error           string  `json:"error,omitempty"`
+}
+
+type CopyDone struct {
+	From            string   `json:"from"`
+	Repository      string   `json:"repository,omitempty"`
+	KeychainProfile string   `json:"keychain_profile,omitempty"`
+	Snapshots       []string `json:"snapshots,omitempty"`
+	Outcome         string   `json:"outcome"`
+	Duration        float64  `json:"duration"`
+	Error           string   `json:"error,omitempty"`
+}
+
+type RunDone struct {
+	Outcome  string  `json:"outcome"`
+	Duration float64 `json:"duration"`
+	Targets  int     `json:"targets"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type StderrLine struct {
+	Line string `json:"line"`
+}
+
+type PingFailed struct {
+	Event string `json:"event"`
+	Error string `json:"error"`
+}
+
+type ErrorMessage struct {
+	Error string `json:"error"`
+}
+
 func decodeResticMessage(data []byte) (any, error) {
 	var shim ResticMessage
 	if err := json.Unmarshal(data, &shim); err != nil {
@@ -79,6 +134,18 @@ func decodeResticMessage(data []byte) (any, error) {
 			return nil, err
 		}
 		return initialized, nil
+	case "change":
+		var change ResticDiffChange
+		if err := json.Unmarshal(data, &change); err != nil {
+			return nil, err
+		}
+		return change, nil
+	case "statistics":
+		var stats ResticDiffStatistics
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return nil, err
+		}
+		return stats, nil
 	default:
 		return nil, fmt.Errorf("unknown message type %s", shim.MessageType)
 	}
@@ -0,0 +1,101 @@
+package restic
+
+import (
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+)
+
+type TargetStatus struct {
+	Repository      string          `json:"repository,omitempty"`
+	KeychainProfile string          `json:"keychain_profile,omitempty"`
+	Latest          *ResticSnapshot `json:"latest,omitempty"`
+	SnapshotCount   int             `json:"snapshot_count"`
+	TotalSize       int             `json:"total_size"`
+	Stale           bool            `json:"stale"`
+	Err             error           `json:"-"`
+}
+
+// Age returns how long ago the newest snapshot was taken, or -1 when the
+// target has no snapshots.
+func (s *TargetStatus) Age(now time.Time) time.Duration {
+	if s.Latest == nil {
+		return -1
+	}
+	return now.Sub(s.Latest.Time)
+}
+
+// Status reports the newest snapshot of opts.SourceHost and the repository
+// stats for every configured target and keychain profile. Errors are recorded
+// per target so one unreachable repository doesn't hide the others.
+func Status(
+	opts *cfg.BackupConfig,
+	maxAge time.Duration,
+	now time.Time,
+) []TargetStatus {
+	var result []TargetStatus
+
+	for _, target := range opts.Targets {
+		resolved, err := resolveTarget(&target)
+		if err != nil {
+			masked, _ := MaskRepository(target.ResticRepository)
+			result = append(result, TargetStatus{Repository: masked, Err: err})
+			continue
+		}
+		result = append(result, targetStatus(opts, resolved, maxAge, now))
+	}
+
+	for _, p := range opts.KeychainProfiles {
+		target, err := loadProfileTarget(p.Profile)
+		if err != nil {
+			result = append(result, TargetStatus{KeychainProfile: p.Profile, Err: err})
+			continue
+		}
+
+		status := targetStatus(opts, target, maxAge, now)
+		status.KeychainProfile = p.Profile
+		result = append(result, status)
+	}
+
+	return result
+}
+
+func targetStatus(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	maxAge time.Duration,
+	now time.Time,
+) TargetStatus {
+	var result TargetStatus
+
+	masked, err := MaskRepository(target.ResticRepository)
+	if err != nil {
+		result.Err = errors.Wrap(err, "mask repo password")
+		return result
+	}
+	result.Repository = masked
+
+	stats, err := stats(opts, target)
+	if err != nil {
+		result.Err = errors.Wrap(err, "stats")
+		return result
+	}
+	result.TotalSize = stats.TotalSize
+	result.SnapshotCount = stats.SnapshotsCount
+
+	snapshots, err := snapshots(opts, target, opts.SourceHost)
+	if err != nil {
+		result.Err = errors.Wrap(err, "snapshots")
+		return result
+	}
+
+	for i := range snapshots {
+		if result.Latest == nil || snapshots[i].Time.After(result.Latest.Time) {
+			result.Latest = &snapshots[i]
+		}
+	}
+
+	result.Stale = result.Latest == nil || (maxAge > 0 && result.Age(now) > maxAge)
+	return result
+}
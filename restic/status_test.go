@@ -0,0 +1,91 @@
+package restic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	// each repository is a directory holding the stats and snapshots output;
+	// a repository that doesn't exist fails like an unreachable one
+	opts, dir := fakeRestic(t, `if [ ! -d "$RESTIC_REPOSITORY" ]; then
+	echo "Fatal: unable to open repository" >&2
+	exit 1
+fi
+case "$*" in
+"stats --json") cat "$RESTIC_REPOSITORY/stats" ;;
+"snapshots --json --host laptop") cat "$RESTIC_REPOSITORY/snapshots" ;;
+*) echo "unexpected: $*" >&2; exit 1 ;;
+esac
+`)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := func(name, snapshots string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.Mkdir(path, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(path, "stats"),
+			[]byte(`{"total_size":1024,"snapshots_count":2}`), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(path, "snapshots"), []byte(snapshots), 0o600))
+		return path
+	}
+
+	fresh := repo("fresh", `[
+		{"id":"a","time":"2024-04-30T12:00:00Z","hostname":"laptop"},
+		{"id":"b","time":"2024-05-01T10:00:00Z","hostname":"laptop"}
+	]`)
+	stale := repo("stale", `[{"id":"c","time":"2024-04-29T12:00:00Z","hostname":"laptop"}]`)
+	empty := repo("empty", `[]`)
+	missing := filepath.Join(dir, "missing")
+
+	opts.SourceHost = "laptop"
+	opts.Targets = []cfg.BackupTarget{
+		{ResticRepository: fresh, ResticPassword: "pw"},
+		{ResticRepository: stale, ResticPassword: "pw"},
+		{ResticRepository: empty, ResticPassword: "pw"},
+		{ResticRepository: missing, ResticPassword: "pw"},
+	}
+
+	results := Status(opts, 24*time.Hour, now)
+	require.Len(t, results, 4)
+
+	tests := []struct {
+		name   string
+		latest string
+		age    time.Duration
+		stale  bool
+		err    bool
+	}{
+		{name: "fresh", latest: "b", age: 2 * time.Hour},
+		{name: "stale", latest: "c", age: 48 * time.Hour, stale: true},
+		{name: "empty", age: -1, stale: true},
+		{name: "missing", age: -1, err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := results[i]
+			assert.Equal(t, filepath.Join(dir, test.name), result.Repository)
+			assert.Equal(t, test.age, result.Age(now))
+			if test.err {
+				assert.ErrorContains(t, result.Err, "stats")
+				return
+			}
+
+			require.NoError(t, result.Err)
+			assert.Equal(t, test.stale, result.Stale)
+			assert.Equal(t, 1024, result.TotalSize)
+			assert.Equal(t, 2, result.SnapshotCount)
+			if test.latest == "" {
+				assert.Nil(t, result.Latest)
+			} else {
+				assert.Equal(t, test.latest, result.Latest.ID)
+			}
+		})
+	}
+}
@@ -2,47 +2,58 @@ package restic
 
 import (
 	"fmt"
-	"net/url"
-	"regexp"
+	"github.com/minor-industries/backup/cfg"
+	"math"
+	"time"
 )
 
-func maskPassword(input string) (string, error) {
-	re := regexp.MustCompile(`^([a-zA-Z]+:)?(.*)`)
-	matches := re.FindStringSubmatch(input)
-	prefix := matches[1]
-	strippedInput := matches[2]
+const defaultQuantum = 0.1
 
-	parsedURL, err := url.Parse(strippedInput)
-	if err != nil {
-		return "", err
-	}
-
-	if parsedURL.User != nil {
-		username := parsedURL.User.Username()
-		if _, hasPassword := parsedURL.User.Password(); hasPassword {
-			parsedURL.User = url.UserPassword(username, "XXXX")
-		} else {
-			parsedURL.User = url.User(username)
-		}
-	}
+func QuantizeFilter(callback func(msg any) error) func(msg any) error {
+	return ThrottleFilter(cfg.ProgressConfig{Quantum: defaultQuantum}, callback)
+}
 
-	return prefix + parsedURL.String(), nil
+// ThrottleFilter limits the rate of ResticStatus messages according to opts.
+// StartBackup and ResticSummary are always forwarded and reset the throttle.
+func ThrottleFilter(opts cfg.ProgressConfig, callback func(msg any) error) func(msg any) error {
+	return throttleFilter(opts, time.Now, callback)
 }
 
-func QuantizeFilter(callback func(msg any) error) func(msg any) error {
+func throttleFilter(
+	opts cfg.ProgressConfig,
+	now func() time.Time,
+	callback func(msg any) error,
+) func(msg any) error {
+	quantum := opts.Quantum
+	if quantum <= 0 {
+		quantum = defaultQuantum
+	}
+
 	lastQuantum := -1.0
+	var lastSent time.Time
 
 	return func(msg any) error {
-		switch msg := msg.(type) {
+		_, inner := Unwrap(msg)
+		switch inner := inner.(type) {
 		case ResticStatus:
-			currentQuantum := float64(int(msg.PercentDone*10)) / 10.0
-			if currentQuantum > lastQuantum {
-				lastQuantum = currentQuantum
+			t := now()
+			elapsed := t.Sub(lastSent)
+			if !lastSent.IsZero() && elapsed < opts.MinInterval {
+				return nil
+			}
+
+			// the epsilon keeps e.g. 0.3/0.1 from rounding down to 2
+			currentQuantum := math.Floor(inner.PercentDone/quantum+1e-9) * quantum
+			heartbeat := opts.MaxInterval > 0 && !lastSent.IsZero() && elapsed >= opts.MaxInterval
+			if currentQuantum > lastQuantum || heartbeat {
+				lastQuantum = max(lastQuantum, currentQuantum)
+				lastSent = t
 				return callback(msg)
 			}
 			return nil
 		case StartBackup, ResticSummary:
 			lastQuantum = -1.0
+			lastSent = time.Time{}
 			return callback(msg)
 		default:
 			return callback(msg)
@@ -51,22 +62,58 @@ func QuantizeFilter(callback func(msg any) error) func(msg any) error {
 }
 
 func LogMessages(callback func(msg string) error) func(msg any) error {
-	return QuantizeFilter(func(msg any) error {
+	return QuantizeFilter(logMessages(callback))
+}
+
+// ThrottledLogMessages is LogMessages with a configurable throttle.
+func ThrottledLogMessages(opts cfg.ProgressConfig, callback func(msg string) error) func(msg any) error {
+	return ThrottleFilter(opts, logMessages(callback))
+}
+
+func logMessages(callback func(msg string) error) func(msg any) error {
+	return func(msg any) error {
+		meta, msg := Unwrap(msg)
+		emit := callback
+		if meta.Target != "" {
+			emit = func(line string) error {
+				return callback(fmt.Sprintf("[%s] %s", meta.Target, line))
+			}
+		}
+
 		switch msg := msg.(type) {
 		case StartBackup:
 			if msg.KeychainProfile != "" {
-				return callback(fmt.Sprintf("loading keychain profile: %s", msg.KeychainProfile))
+				return emit(fmt.Sprintf("loading keychain profile: %s", msg.KeychainProfile))
 			}
 			if msg.Repository != "" {
-				return callback(fmt.Sprintf("starting backup: %s", msg.Repository))
+				return emit(fmt.Sprintf("starting backup: %s", msg.Repository))
 			}
 		case ResticStatus:
-			return callback(fmt.Sprintf("progress: %.1f%%", msg.PercentDone*100))
+			return emit(fmt.Sprintf("progress: %.1f%%", msg.PercentDone*100))
 		case ResticSummary:
-			return callback("backup done")
+			return emit("backup done")
+		case ResticInitialized:
+			return emit(fmt.Sprintf("repository initialized: %s", msg.ID))
+		case StderrLine:
+			return emit(fmt.Sprintf("restic: %s", msg.Line))
+		case PingFailed:
+			return emit(fmt.Sprintf("ping %s failed: %s", msg.Event, msg.Error))
+		case TargetDone:
+			if msg.Error != "" {
+				return emit(fmt.Sprintf("backup failed: %s", msg.Error))
+			}
+		case CopyDone:
+			if msg.Error != "" {
+				return emit(fmt.Sprintf("copy from %s failed: %s", msg.From, msg.Error))
+			}
+			return emit(fmt.Sprintf("copied %d snapshot(s) from %s", len(msg.Snapshots), msg.From))
+		case ErrorMessage:
+			return emit(fmt.Sprintf("error: %s", msg.Error))
+		case RunDone:
+			return emit(fmt.Sprintf("run %s after %.1fs", msg.Outcome, msg.Duration))
 		default:
-			return callback("unknown message type")
+			return emit("unknown message type")
 		}
 		return nil
-	})
+	}
 }
@@ -0,0 +1,129 @@
+package restic
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/minor-industries/backup/secrets"
+	"github.com/pkg/errors"
+)
+
+// EnvVar describes an environment variable restic reads its repository
+// settings or backend credentials from.
+type EnvVar struct {
+	Name string
+	// Backend is the backend the variable applies to, empty for all backends.
+	Backend  string
+	Secret   bool
+	Required bool
+}
+
+// KnownEnvVars lists the variables profiles and targets are expected to
+// carry. The sftp backend authenticates through ssh and has none; rclone
+// remotes are configured with arbitrary RCLONE_CONFIG_* variables.
+var KnownEnvVars = []EnvVar{
+	{Name: "RESTIC_REPOSITORY", Required: true},
+	{Name: "RESTIC_PASSWORD", Secret: true, Required: true},
+
+	{Name: "AWS_ACCESS_KEY_ID", Backend: BackendS3, Secret: true},
+	{Name: "AWS_SECRET_ACCESS_KEY", Backend: BackendS3, Secret: true},
+	{Name: "AWS_SESSION_TOKEN", Backend: BackendS3, Secret: true},
+	{Name: "AWS_DEFAULT_REGION", Backend: BackendS3},
+	{Name: "AWS_PROFILE", Backend: BackendS3},
+	{Name: "AWS_SHARED_CREDENTIALS_FILE", Backend: BackendS3},
+
+	{Name: "B2_ACCOUNT_ID", Backend: BackendB2, Required: true},
+	{Name: "B2_ACCOUNT_KEY", Backend: BackendB2, Secret: true, Required: true},
+
+	{Name: "AZURE_ACCOUNT_NAME", Backend: BackendAzure, Required: true},
+	{Name: "AZURE_ACCOUNT_KEY", Backend: BackendAzure, Secret: true},
+	{Name: "AZURE_ACCOUNT_SAS", Backend: BackendAzure, Secret: true},
+	{Name: "AZURE_ENDPOINT_SUFFIX", Backend: BackendAzure},
+
+	{Name: "GOOGLE_PROJECT_ID", Backend: BackendGS, Required: true},
+	{Name: "GOOGLE_APPLICATION_CREDENTIALS", Backend: BackendGS},
+	{Name: "GOOGLE_ACCESS_TOKEN", Backend: BackendGS, Secret: true},
+
+	{Name: "OS_AUTH_URL", Backend: BackendSwift},
+	{Name: "OS_REGION_NAME", Backend: BackendSwift},
+	{Name: "OS_USERNAME", Backend: BackendSwift},
+	{Name: "OS_PASSWORD", Backend: BackendSwift, Secret: true},
+	{Name: "OS_PROJECT_NAME", Backend: BackendSwift},
+	{Name: "OS_PROJECT_DOMAIN_NAME", Backend: BackendSwift},
+	{Name: "OS_USER_DOMAIN_NAME", Backend: BackendSwift},
+	{Name: "OS_APPLICATION_CREDENTIAL_ID", Backend: BackendSwift},
+	{Name: "OS_APPLICATION_CREDENTIAL_SECRET", Backend: BackendSwift, Secret: true},
+	{Name: "OS_AUTH_TOKEN", Backend: BackendSwift, Secret: true},
+	{Name: "OS_STORAGE_URL", Backend: BackendSwift},
+
+	{Name: "RESTIC_REST_USERNAME", Backend: BackendREST},
+	{Name: "RESTIC_REST_PASSWORD", Backend: BackendREST, Secret: true},
+}
+
+// LookupEnvVar returns the schema of the named variable.
+func LookupEnvVar(name string) (EnvVar, bool) {
+	for _, v := range KnownEnvVars {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return EnvVar{}, false
+}
+
+// BackendEnvVars returns the variables specific to backend.
+func BackendEnvVars(backend string) []EnvVar {
+	var result []EnvVar
+	for _, v := range KnownEnvVars {
+		if v.Backend != "" && v.Backend == backend {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// IsSecretEnvVar reports whether the value of the named variable must be
+// kept out of output. Unknown variables are secret when their name suggests
+// so, e.g. RCLONE_CONFIG_MYREMOTE_PASS.
+func IsSecretEnvVar(name string) bool {
+	if v, ok := LookupEnvVar(name); ok {
+		return v.Secret
+	}
+	return isSensitive(name)
+}
+
+// ValidateEnv checks that vars has a parseable repository, a password and
+// every variable its backend requires. Secret references are not resolved.
+func ValidateEnv(vars map[string]string) error {
+	for _, v := range KnownEnvVars {
+		if v.Backend == "" && v.Required && vars[v.Name] == "" {
+			return fmt.Errorf("%s is required", v.Name)
+		}
+	}
+
+	repo := vars["RESTIC_REPOSITORY"]
+	if secrets.IsReference(repo) {
+		return nil
+	}
+
+	loc, err := ParseRepository(repo)
+	if err != nil {
+		return errors.Wrap(err, "parse repository")
+	}
+
+	for _, v := range BackendEnvVars(loc.Backend) {
+		if v.Required && vars[v.Name] == "" {
+			return fmt.Errorf("%s is required for the %s backend", v.Name, loc.Backend)
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,44 @@
+package restic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEnv(t *testing.T) {
+	tests := []struct {
+		vars     map[string]string
+		expected string
+	}{
+		{
+			vars:     map[string]string{"RESTIC_REPOSITORY": "/srv/restic", "RESTIC_PASSWORD": "pw"},
+			expected: "",
+		},
+		{
+			vars:     map[string]string{"RESTIC_REPOSITORY": "/srv/restic"},
+			expected: "RESTIC_PASSWORD is required",
+		},
+		{
+			vars:     map[string]string{"RESTIC_REPOSITORY": "b2:bucket:path", "RESTIC_PASSWORD": "pw", "B2_ACCOUNT_ID": "id"},
+			expected: "B2_ACCOUNT_KEY is required for the b2 backend",
+		},
+		{
+			vars:     map[string]string{"RESTIC_REPOSITORY": "sftp:host", "RESTIC_PASSWORD": "pw"},
+			expected: "parse repository: invalid sftp repository: missing path",
+		},
+		{
+			vars:     map[string]string{"RESTIC_REPOSITORY": "env:NAS_REPO", "RESTIC_PASSWORD": "env:NAS_PW"},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		err := ValidateEnv(test.vars)
+		if test.expected == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package restic
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+)
+
+// Failure classifies why restic couldn't open a repository.
+type Failure string
+
+const (
+	FailureRepoMissing   Failure = "repo_missing"
+	FailureWrongPassword Failure = "wrong_password"
+	FailureUnreachable   Failure = "unreachable"
+	FailureUnknown       Failure = "unknown"
+)
+
+// exit codes of restic 0.17 and later
+const (
+	exitRepoMissing   = 10
+	exitWrongPassword = 12
+)
+
+var failurePatterns = []struct {
+	failure  Failure
+	patterns []string
+}{
+	{FailureRepoMissing, []string{
+		"repository does not exist",
+		"Is there a repository at the following location?",
+		"unable to open config file",
+	}},
+	{FailureWrongPassword, []string{
+		"wrong password or no key found",
+	}},
+	{FailureUnreachable, []string{
+		"no such host",
+		"connection refused",
+		"network is unreachable",
+		"i/o timeout",
+		"connection reset",
+		"TLS handshake",
+		"certificate",
+		"Permission denied",
+	}},
+}
+
+// VerifyError is returned by Verify when the repository can't be opened.
+type VerifyError struct {
+	Failure Failure
+	Err     error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Failure.Description(), e.Err)
+}
+
+func (e *VerifyError) Unwrap() error { return e.Err }
+
+// Description returns a short human-readable explanation of f.
+func (f Failure) Description() string {
+	switch f {
+	case FailureRepoMissing:
+		return "repository does not exist"
+	case FailureWrongPassword:
+		return "wrong password"
+	case FailureUnreachable:
+		return "repository is unreachable"
+	default:
+		return "cannot open repository"
+	}
+}
+
+// ClassifyError tells apart the common reasons a restic command fails to open
+// a repository, first by restic's exit code and otherwise by its message.
+func ClassifyError(err error) Failure {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case exitRepoMissing:
+			return FailureRepoMissing
+		case exitWrongPassword:
+			return FailureWrongPassword
+		}
+	}
+
+	msg := err.Error()
+	for _, p := range failurePatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(msg, pattern) {
+				return p.failure
+			}
+		}
+	}
+	return FailureUnknown
+}
+
+// Verify opens the repository of target and decrypts its config, which is
+// much cheaper than Stats but fails the same way on a wrong repository or
+// password. Failures are returned as a *VerifyError.
+func Verify(opts *cfg.BackupConfig, target *cfg.BackupTarget) error {
+	target, err := resolveTarget(target)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(opts.ResticPath, "cat", "config", "--json")
+
+	var config struct {
+		Version int    `json:"version"`
+		ID      string `json:"id"`
+	}
+	if err := jsonResticCommand(target, cmd, &config); err != nil {
+		return &VerifyError{Failure: ClassifyError(err), Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package restic
+
+import (
+	"testing"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		script   string
+		expected Failure
+	}{
+		{`echo '{"version":2,"id":"abc"}'`, ""},
+		{`echo "Fatal: repository does not exist" >&2; exit 10`, FailureRepoMissing},
+		{`echo "Fatal: wrong password or no key found" >&2; exit 12`, FailureWrongPassword},
+		{`echo "Fatal: unable to open config file: stat /srv/restic/config: no such file or directory" >&2
+echo "Is there a repository at the following location?" >&2; exit 1`, FailureRepoMissing},
+		{`echo "Fatal: wrong password or no key found" >&2; exit 1`, FailureWrongPassword},
+		{`echo "dial tcp: lookup nas.example: no such host" >&2; exit 1`, FailureUnreachable},
+		{`echo "something else" >&2; exit 1`, FailureUnknown},
+	}
+
+	for _, test := range tests {
+		opts, _ := fakeRestic(t, test.script+"\n")
+
+		err := Verify(
+			opts,
+			&cfg.BackupTarget{ResticRepository: "/srv/restic", ResticPassword: "hunter2"},
+		)
+		if test.expected == "" {
+			assert.NoError(t, err)
+			continue
+		}
+
+		var verifyErr *VerifyError
+		require.True(t, errors.As(err, &verifyErr), test.script)
+		assert.Equal(t, test.expected, verifyErr.Failure, test.script)
+		assert.NotContains(t, err.Error(), "hunter2")
+	}
+}
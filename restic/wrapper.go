@@ -7,30 +7,68 @@ import (
 	"fmt"
 	"github.com/minor-industries/backup/cfg"
 	"github.com/minor-industries/backup/keychain"
+	"github.com/minor-industries/backup/secrets"
 	"github.com/pkg/errors"
 	"io"
 	"os"
 	"os/exec"
+	"sync"
+	"time"
 )
 
 func RunConsole(
 	opts *cfg.BackupConfig,
 	chdir string,
 	backupPaths []string,
-) error {
+) (err error) {
+	redactor := NewRedactor(opts.Targets...)
+	p := newPinger(opts.Ping, func(msg PingFailed) {
+		fmt.Fprintf(os.Stderr, "ping %s failed: %s\n", msg.Event, redactor.String(msg.Error))
+	})
+	p.Start()
+
+	defer func() {
+		err = redactor.Error(err)
+		if err != nil {
+			p.Fail(err.Error())
+		} else {
+			p.Success("")
+		}
+	}()
+
 	if len(backupPaths) == 0 {
 		return errors.New("no backup paths given")
 	}
 
-	allTargets, err := loadProfilesAndCheckTargets(opts, nil)
+	targets, err := loadProfilesAndCheckTargets(opts, nil, redactor)
 	if err != nil {
 		return errors.Wrap(err, "check targets")
 	}
 
-	for _, target := range allTargets {
-		if err := BackupOneConsole(opts, &target, chdir, backupPaths); err != nil {
+	primaries, replicas, err := splitReplicas(targets)
+	if err != nil {
+		return errors.Wrap(err, "check targets")
+	}
+
+	for _, target := range primaries {
+		if err := backupOneConsole(opts, &target, chdir, backupPaths); err != nil {
 			return errors.Wrap(err, "backup one")
 		}
+		if err := recordSuccess(&target, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, redactor.String(err.Error()))
+		}
+	}
+
+	for _, rep := range replicas {
+		fmt.Printf("copying snapshots from %s to: %s\n", targetMeta(&rep.from).Target, targetMeta(&rep.to).Repository)
+		result, err := copySnapshots(opts, &rep.from, &rep.to, replicaFilter(opts))
+		if err != nil {
+			return errors.Wrap(err, "copy to replica")
+		}
+		fmt.Printf("copied %d snapshot(s)\n", len(result.Copied))
+		if err := recordSuccess(&rep.to, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, redactor.String(err.Error()))
+		}
 	}
 
 	return nil
@@ -41,20 +79,68 @@ func Run(
 	chdir string,
 	backupPaths []string,
 	callback func(any) error,
-) error {
+) (err error) {
+	r := newRun(opts, callback)
+	emit := r.callbackFor(nil)
+	started := r.now()
+
+	p := newPinger(opts.Ping, func(msg PingFailed) {
+		// a failing callback must not turn a ping problem into a backup failure
+		_ = emit(msg)
+	})
+	p.Start()
+
+	var summaries []ResticSummary
+	var numTargets int
+	defer func() {
+		done := RunDone{
+			Outcome:  OutcomeSuccess,
+			Duration: r.now().Sub(started).Seconds(),
+			Targets:  numTargets,
+		}
+		err = r.redactor.Error(err)
+		if err != nil {
+			_ = emit(ErrorMessage{Error: err.Error()})
+			p.Fail(err.Error())
+			done.Outcome = OutcomeFailure
+			done.Error = err.Error()
+		} else {
+			p.Success(summaryText(summaries))
+		}
+		_ = emit(done)
+	}()
+
 	if len(backupPaths) == 0 {
 		return errors.New("no backup paths given")
 	}
 
-	allTargets, err := loadProfilesAndCheckTargets(opts, callback)
+	targets, err := loadProfilesAndCheckTargets(opts, r, r.redactor)
 	if err != nil {
 		return errors.Wrap(err, "check targets")
 	}
 
-	for _, target := range allTargets {
-		if err := BackupOne(opts, &target, chdir, backupPaths, callback); err != nil {
+	primaries, replicas, err := splitReplicas(targets)
+	if err != nil {
+		return errors.Wrap(err, "check targets")
+	}
+
+	for _, target := range primaries {
+		numTargets++
+		summary, err := backupTarget(opts, &target, chdir, backupPaths, r)
+		if err != nil {
 			return errors.Wrap(err, "backup one")
 		}
+		if summary != nil {
+			summaries = append(summaries, *summary)
+		}
+	}
+
+	// replicas are only copied to once every primary is backed up
+	for _, rep := range replicas {
+		numTargets++
+		if err := copyTarget(opts, &rep, r); err != nil {
+			return errors.Wrap(err, "copy to replica")
+		}
 	}
 
 	return nil
@@ -62,57 +148,168 @@ func Run(
 
 func loadProfilesAndCheckTargets(
 	opts *cfg.BackupConfig,
-	callback func(any) error,
+	r *run,
+	redactor *Redactor,
 ) ([]cfg.BackupTarget, error) {
-	// check all targets with stats command before starting backup
-	for _, target := range opts.Targets {
-		if _, err := Stats(opts, &target); err != nil {
+	// resolve secret references once, then check all targets with stats
+	// command before starting backup
+	targets := make([]cfg.BackupTarget, len(opts.Targets))
+	for i := range opts.Targets {
+		target, err := resolveTarget(&opts.Targets[i])
+		if err != nil {
+			return nil, err
+		}
+		redactor.Add(*target)
+		targets[i] = *target
+	}
+
+	for _, target := range targets {
+		if _, err := stats(opts, &target); err != nil {
 			return nil, errors.Wrap(err, "check target")
 		}
 	}
 
 	// load keychain profiles
-	profiles := make([]*keychain.Profile, len(opts.KeychainProfiles))
 	profileTargets := make([]cfg.BackupTarget, len(opts.KeychainProfiles))
 	for i, p := range opts.KeychainProfiles {
-		if callback != nil {
-			if err := callback(StartBackup{KeychainProfile: p.Profile}); err != nil {
-				return nil, errors.Wrap(err, "callback")
-			}
+		meta := Meta{Target: p.Profile, KeychainProfile: p.Profile}
+		if err := r.emit(meta, StartBackup{KeychainProfile: p.Profile}); err != nil {
+			return nil, errors.Wrap(err, "callback")
 		}
 
-		var err error
-		profiles[i], err = keychain.LoadProfile(p.Profile)
+		target, err := loadProfileTarget(p.Profile)
 		if err != nil {
-			return nil, errors.Wrap(err, "load keychain profile")
-		}
-
-		profileTargets[i] = cfg.BackupTarget{
-			AwsAccessKeyId:     profiles[i].AwsAccessKeyID,
-			AwsSecretAccessKey: profiles[i].AwsSecretAccessKey,
-			ResticRepository:   profiles[i].ResticRepository,
-			ResticPassword:     profiles[i].ResticPassword,
+			return nil, err
 		}
+		target.ReplicaOf = p.ReplicaOf
+		redactor.Add(*target)
+		profileTargets[i] = *target
 	}
 
 	// check keychain profiles with stats command before starting
 	for _, target := range profileTargets {
-		if _, err := Stats(opts, &target); err != nil {
+		if _, err := stats(opts, &target); err != nil {
 			return nil, errors.Wrap(err, "check profile")
 		}
 	}
 
-	allTargets := append(opts.Targets, profileTargets...)
+	allTargets := append(targets, profileTargets...)
 	return allTargets, nil
 }
 
+// resolveTarget returns a copy of target with its secret references
+// resolved.
+func resolveTarget(target *cfg.BackupTarget) (*cfg.BackupTarget, error) {
+	resolved, err := secrets.ResolveTarget(*target)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve target secrets")
+	}
+	return &resolved, nil
+}
+
+func loadProfileTarget(profileName string) (*cfg.BackupTarget, error) {
+	profile, err := keychain.LoadProfile(profileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "load keychain profile")
+	}
+
+	// profile values may themselves be references, e.g. "cmd:pass show nas"
+	target := ProfileTarget(profileName, profile)
+	return resolveTarget(&target)
+}
+
+// ProfileTarget returns the target described by a keychain profile, with
+// secret references left unresolved.
+func ProfileTarget(profileName string, profile *keychain.Profile) cfg.BackupTarget {
+	return cfg.BackupTarget{
+		AwsAccessKeyId:     profile.AwsAccessKeyID,
+		AwsSecretAccessKey: profile.AwsSecretAccessKey,
+		ResticRepository:   profile.ResticRepository,
+		ResticPassword:     profile.ResticPassword,
+		Env:                profile.Env,
+		KeychainProfile:    profileName,
+	}
+}
+
+// backupTarget backs up to a single target and reports the outcome with a
+// TargetDone message. It returns the restic summary if one was received.
+func backupTarget(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	chdir string,
+	backupPaths []string,
+	r *run,
+) (*ResticSummary, error) {
+	emit := r.callbackFor(target)
+	started := r.now()
+
+	var summary *ResticSummary
+	err := backupOne(opts, target, chdir, backupPaths, func(msg any) error {
+		if s, ok := msg.(ResticSummary); ok {
+			summary = &s
+		}
+		return emit(msg)
+	})
+
+	done := TargetDone{
+		Repository:      targetMeta(target).Repository,
+		KeychainProfile: target.KeychainProfile,
+		Outcome:         OutcomeSuccess,
+		Duration:        r.now().Sub(started).Seconds(),
+	}
+	if summary != nil {
+		done.SnapshotID = summary.SnapshotID
+	}
+	if err != nil {
+		done.Outcome = OutcomeFailure
+		done.Error = err.Error()
+	}
+
+	if err == nil {
+		// a lost timestamp isn't worth failing the backup over, so it is only
+		// reported
+		if recordErr := recordSuccess(target, r.now()); recordErr != nil {
+			_ = emit(StderrLine{Line: recordErr.Error()})
+		}
+	}
+
+	if cbErr := emit(done); cbErr != nil && err == nil {
+		return nil, errors.Wrap(cbErr, "callback")
+	}
+
+	return summary, err
+}
+
+// recordSuccess stores the time of a successful backup in the target's
+// keychain profile, if it came from one.
+func recordSuccess(target *cfg.BackupTarget, now time.Time) error {
+	if target.KeychainProfile == "" {
+		return nil
+	}
+	err := keychain.RecordSuccess(target.KeychainProfile, now)
+	return errors.Wrap(err, "record last success in profile")
+}
+
 func BackupOneConsole(
 	opts *cfg.BackupConfig,
 	target *cfg.BackupTarget,
 	chdir string,
 	backupPaths []string,
 ) error {
-	masked, err := maskPassword(target.ResticRepository)
+	target, err := resolveTarget(target)
+	if err != nil {
+		return err
+	}
+	return backupOneConsole(opts, target, chdir, backupPaths)
+}
+
+func backupOneConsole(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	chdir string,
+	backupPaths []string,
+) error {
+	masked, err := MaskRepository(target.ResticRepository)
 	if err != nil {
 		return errors.Wrap(err, "mask repo password")
 	}
@@ -136,12 +333,31 @@ func BackupOneConsole(
 		cmd.Dir = chdir
 	}
 
-	addEnv(target, cmd)
+	cleanup, err := addEnv(target, cmd)
+	if err != nil {
+		return errors.Wrap(err, "prepare restic command")
+	}
+	defer cleanup()
 
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return errors.Wrap(err, "get stderr pipe")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "start restic")
+	}
 
-	err = cmd.Run()
+	// restic's errors may quote the repository with its credentials
+	redactor := NewRedactor(*target)
+	scanner := bufio.NewScanner(stderrPipe)
+	for scanner.Scan() {
+		fmt.Fprintln(os.Stderr, redactor.String(scanner.Text()))
+	}
+	io.Copy(io.Discard, stderrPipe)
+
+	err = cmd.Wait()
 	return errors.Wrap(err, "run")
 }
 
@@ -152,7 +368,25 @@ func BackupOne(
 	backupPaths []string,
 	callback func(any) error,
 ) error {
-	masked, err := maskPassword(target.ResticRepository)
+	r := newRun(opts, callback)
+	target, err := resolveTarget(target)
+	if err != nil {
+		return err
+	}
+	err = backupOne(opts, target, chdir, backupPaths, r.callbackFor(target))
+	return r.redactor.Error(err)
+}
+
+// backupOne is BackupOne with a callback that already wraps messages in
+// envelopes.
+func backupOne(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	chdir string,
+	backupPaths []string,
+	callback func(any) error,
+) error {
+	masked, err := MaskRepository(target.ResticRepository)
 	if err != nil {
 		return errors.Wrap(err, "mask repo password")
 	}
@@ -187,36 +421,135 @@ func InitRepo(
 	target *cfg.BackupTarget,
 	callback func(any) error,
 ) error {
+	r := newRun(opts, callback)
+	target, err := resolveTarget(target)
+	if err != nil {
+		return err
+	}
 	cmd := exec.Command(opts.ResticPath, "init", "--json")
-	return streamingResticCommand(target, cmd, callback)
+	err = streamingResticCommand(target, cmd, r.callbackFor(target))
+	return r.redactor.Error(err)
 }
 
 func Stats(
 	opts *cfg.BackupConfig,
 	target *cfg.BackupTarget,
 ) (*ResticStats, error) {
-	cmd := exec.Command(opts.ResticPath, "stats", "--json")
-	addEnv(target, cmd)
-
-	output, err := cmd.CombinedOutput()
+	target, err := resolveTarget(target)
 	if err != nil {
-		return nil, errors.Wrapf(err, "run (output: %s)", string(output))
+		return nil, err
 	}
+	return stats(opts, target)
+}
+
+// stats is Stats for a target whose secrets are already resolved.
+func stats(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+) (*ResticStats, error) {
+	cmd := exec.Command(opts.ResticPath, "stats", "--json")
 
 	var stats ResticStats
-	if err := json.Unmarshal(output, &stats); err != nil {
-		return nil, errors.Wrap(err, "unmarshal")
+	if err := jsonResticCommand(target, cmd, &stats); err != nil {
+		return nil, err
 	}
 
 	return &stats, nil
 }
 
+func Snapshots(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	host string,
+) ([]ResticSnapshot, error) {
+	target, err := resolveTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return snapshots(opts, target, host)
+}
+
+// snapshots is Snapshots for a target whose secrets are already resolved.
+func snapshots(
+	opts *cfg.BackupConfig,
+	target *cfg.BackupTarget,
+	host string,
+) ([]ResticSnapshot, error) {
+	args := []string{"snapshots", "--json"}
+	if host != "" {
+		args = append(args, "--host", host)
+	}
+
+	cmd := exec.Command(opts.ResticPath, args...)
+
+	var snapshots []ResticSnapshot
+	if err := jsonResticCommand(target, cmd, &snapshots); err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// jsonResticCommand runs a restic command that prints a single JSON document
+// and decodes it into result.
+func jsonResticCommand(
+	target *cfg.BackupTarget,
+	cmd *exec.Cmd,
+	result any,
+) error {
+	stdout, err := runResticCommand(target, cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(stdout, result); err != nil {
+		return errors.Wrap(err, "unmarshal")
+	}
+
+	return nil
+}
+
+// runResticCommand runs a restic command to completion and returns its
+// standard output.
+func runResticCommand(
+	target *cfg.BackupTarget,
+	cmd *exec.Cmd,
+) ([]byte, error) {
+	cleanup, err := addEnv(target, cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "prepare restic command")
+	}
+	defer cleanup()
+
+	return runPreparedCommand(cmd, NewRedactor(*target))
+}
+
+// runPreparedCommand runs a restic command whose environment is already set
+// up and returns its standard output. Errors include restic's output,
+// redacted with redactor.
+func runPreparedCommand(cmd *exec.Cmd, redactor *Redactor) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		err = errors.Wrapf(err, "run (output: %s%s)", stdout.String(), stderr.String())
+		return nil, redactor.Error(err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
 func streamingResticCommand(
 	target *cfg.BackupTarget,
 	cmd *exec.Cmd,
 	callback func(any) error,
 ) error {
-	addEnv(target, cmd)
+	cleanup, err := addEnv(target, cmd)
+	if err != nil {
+		return errors.Wrap(err, "prepare restic command")
+	}
+	defer cleanup()
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
@@ -238,37 +571,55 @@ func streamingResticCommand(
 	stderrCh := make(chan string)
 	defer close(stderrCh)
 
+	// cmd.Wait closes the pipes, so it may only be called once both readers
+	// are done
+	var readers sync.WaitGroup
+	readers.Add(2)
+
 	numProcs++
 	go func() {
-		scanner := bufio.NewScanner(stdoutPipe)
-		for scanner.Scan() {
-			line := scanner.Bytes()
-
-			msg, err := decodeResticMessage(line)
-			if err != nil {
-				errCh <- errors.Wrap(err, "decode restic message")
-				return
-			}
-
-			if err := callback(msg); err != nil {
-				errCh <- errors.Wrap(err, "callback returned error")
-				return
+		err := func() error {
+			scanner := bufio.NewScanner(stdoutPipe)
+			for scanner.Scan() {
+				line := scanner.Bytes()
+
+				msg, err := decodeResticMessage(line)
+				if err != nil {
+					return errors.Wrap(err, "decode restic message")
+				}
+
+				if err := callback(msg); err != nil {
+					return errors.Wrap(err, "callback returned error")
+				}
 			}
-		}
+			return nil
+		}()
 
-		errCh <- nil
+		// keep draining stdout after an error so restic doesn't block
+		io.Copy(io.Discard, stdoutPipe)
+		readers.Done()
+		errCh <- err
 	}()
 
 	numProcs++
 	go func() {
 		var stderrBuffer bytes.Buffer
+		var callbackErr error
+		scanner := bufio.NewScanner(io.TeeReader(stderrPipe, &stderrBuffer))
+		for scanner.Scan() {
+			if callbackErr == nil {
+				callbackErr = callback(StderrLine{Line: scanner.Text()})
+			}
+		}
 		io.Copy(&stderrBuffer, stderrPipe)
+		readers.Done()
 		stderrCh <- stderrBuffer.String()
-		errCh <- nil
+		errCh <- errors.Wrap(callbackErr, "callback returned error")
 	}()
 
 	numProcs++
 	go func() {
+		readers.Wait()
 		err := cmd.Wait()
 		stderr := <-stderrCh
 		if err != nil {
@@ -291,15 +642,3 @@ func streamingResticCommand(
 
 	return nil
 }
-
-func addEnv(target *cfg.BackupTarget, cmd *exec.Cmd) {
-	cmd.Env = append(os.Environ(),
-		"AWS_ACCESS_KEY_ID="+target.AwsAccessKeyId,
-		"AWS_SECRET_ACCESS_KEY="+target.AwsSecretAccessKey,
-		"RESTIC_REPOSITORY="+target.ResticRepository,
-		"RESTIC_PASSWORD="+target.ResticPassword,
-	)
-	if target.CACertPath != "" {
-		cmd.Env = append(cmd.Env, "RESTIC_CACERT="+os.ExpandEnv(target.CACertPath))
-	}
-}
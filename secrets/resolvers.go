@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/minor-industries/backup/keychain"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	Register("literal", resolveLiteral)
+	Register("env", resolveEnv)
+	Register("file", resolveFile)
+	Register("cmd", resolveCmd)
+	Register("keychain", resolveKeychain)
+}
+
+func resolveLiteral(ref string, _ string) (string, error) {
+	return ref, nil
+}
+
+func resolveEnv(ref string, _ string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+func resolveFile(ref string, _ string) (string, error) {
+	content, err := os.ReadFile(os.ExpandEnv(ref))
+	if err != nil {
+		// the error only contains the path
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func resolveCmd(ref string, _ string) (string, error) {
+	cmd := exec.Command("/bin/sh", "-c", ref)
+	cmd.Stderr = os.Stderr
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	// only the exit status is reported, the output may contain the secret
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, "run command")
+	}
+
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// resolveKeychain resolves "keychain:profile" to the field being resolved of
+// the given keychain profile, or "keychain:profile#FIELD" to another field.
+func resolveKeychain(ref string, field string) (string, error) {
+	name, other, found := strings.Cut(ref, "#")
+	if found {
+		field = other
+	}
+
+	profile, err := keychain.LoadProfile(name)
+	if err != nil {
+		return "", errors.Wrap(err, "load profile")
+	}
+
+	value := profile.Get(field)
+	if value == "" {
+		return "", fmt.Errorf("profile %s has no %s", name, field)
+	}
+	return value, nil
+}
@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Resolver returns the secret a reference points to. field is the name of the
+// setting being resolved, e.g. RESTIC_PASSWORD, for resolvers that store
+// several secrets under one name.
+type Resolver func(ref string, field string) (string, error)
+
+var (
+	mu        sync.RWMutex
+	resolvers = map[string]Resolver{}
+)
+
+// Register makes a resolver available for values of the form "scheme:ref".
+func Register(scheme string, resolver Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+	resolvers[scheme] = resolver
+}
+
+// Schemes lists the registered schemes.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	result := make([]string, 0, len(resolvers))
+	for scheme := range resolvers {
+		result = append(result, scheme)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func lookup(value string) (Resolver, string, string, bool) {
+	scheme, ref, found := strings.Cut(value, ":")
+	if !found {
+		return nil, "", "", false
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	resolver, ok := resolvers[scheme]
+	return resolver, scheme, ref, ok
+}
+
+// IsReference reports whether value refers to a secret stored elsewhere.
+func IsReference(value string) bool {
+	_, _, _, ok := lookup(value)
+	return ok
+}
+
+// Scheme returns the scheme of value if it is a reference.
+func Scheme(value string) (string, bool) {
+	_, scheme, _, ok := lookup(value)
+	return scheme, ok
+}
+
+// Resolve returns the secret value refers to, or value itself when it doesn't
+// start with a registered scheme. A literal value that happens to start with a
+// scheme can be written as "literal:value". Errors name the reference but
+// never the resolved value.
+func Resolve(value string, field string) (string, error) {
+	resolver, scheme, ref, ok := lookup(value)
+	if !ok {
+		return value, nil
+	}
+
+	result, err := resolver(ref, field)
+	if err != nil {
+		return "", errors.Wrapf(err, "resolve %s reference %q", scheme, value)
+	}
+	return result, nil
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minor-industries/backup/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	pwFile := filepath.Join(dir, "pw")
+	require.NoError(t, os.WriteFile(pwFile, []byte("from-file\n"), 0o600))
+
+	t.Setenv("BACKUP_TEST_PW", "from-env")
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"/srv/restic", "/srv/restic"},
+		{"s3:s3.amazonaws.com/bucket", "s3:s3.amazonaws.com/bucket"},
+		{"literal:env:NOT_A_REFERENCE", "env:NOT_A_REFERENCE"},
+		{"env:BACKUP_TEST_PW", "from-env"},
+		{"file:" + pwFile, "from-file"},
+		{"cmd:echo from-cmd", "from-cmd"},
+	}
+
+	for _, test := range tests {
+		result, err := Resolve(test.value, "RESTIC_PASSWORD")
+		require.NoError(t, err, test.value)
+		assert.Equal(t, test.expected, result)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	_, err := Resolve("env:BACKUP_TEST_UNSET", "RESTIC_PASSWORD")
+	assert.EqualError(t, err,
+		`resolve env reference "env:BACKUP_TEST_UNSET": environment variable BACKUP_TEST_UNSET is not set`)
+
+	// the command output is never part of the error
+	t.Setenv("BACKUP_TEST_PW", "hunter2")
+	_, err = Resolve("cmd:echo $BACKUP_TEST_PW; exit 3", "RESTIC_PASSWORD")
+	assert.EqualError(t, err,
+		`resolve cmd reference "cmd:echo $BACKUP_TEST_PW; exit 3": run command: exit status 3`)
+}
+
+func TestResolveTarget(t *testing.T) {
+	t.Setenv("BACKUP_TEST_PW", "from-env")
+
+	target, err := ResolveTarget(cfg.BackupTarget{
+		Name:             "nas",
+		ResticRepository: "/srv/restic",
+		ResticPassword:   "env:BACKUP_TEST_PW",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.BackupTarget{
+		Name:             "nas",
+		ResticRepository: "/srv/restic",
+		ResticPassword:   "from-env",
+	}, target)
+
+	_, err = ResolveTarget(cfg.BackupTarget{AwsSecretAccessKey: "env:BACKUP_TEST_UNSET"})
+	assert.ErrorContains(t, err, "AWS_SECRET_ACCESS_KEY: resolve env reference")
+}
@@ -0,0 +1,41 @@
+package secrets
+
+import (
+	"github.com/minor-industries/backup/cfg"
+	"github.com/pkg/errors"
+)
+
+// ResolveTarget returns a copy of target with all secret references resolved.
+func ResolveTarget(target cfg.BackupTarget) (cfg.BackupTarget, error) {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"RESTIC_REPOSITORY", &target.ResticRepository},
+		{"RESTIC_PASSWORD", &target.ResticPassword},
+		{"AWS_ACCESS_KEY_ID", &target.AwsAccessKeyId},
+		{"AWS_SECRET_ACCESS_KEY", &target.AwsSecretAccessKey},
+	}
+
+	for _, f := range fields {
+		resolved, err := Resolve(*f.value, f.name)
+		if err != nil {
+			return cfg.BackupTarget{}, errors.Wrap(err, f.name)
+		}
+		*f.value = resolved
+	}
+
+	if target.Env != nil {
+		env := make(map[string]string, len(target.Env))
+		for name, value := range target.Env {
+			resolved, err := Resolve(value, name)
+			if err != nil {
+				return cfg.BackupTarget{}, errors.Wrap(err, name)
+			}
+			env[name] = resolved
+		}
+		target.Env = env
+	}
+
+	return target, nil
+}